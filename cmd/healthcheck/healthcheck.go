@@ -1,7 +1,8 @@
 /*
 Healthcheck is a simple program that sends an HTTP request to the local host (self) to a configured port number.
 It's used in environment where you need a simple probe for health checks (e.g., an empty container in docker).
-The probe URL is http://localhost:3000/liveness . Only the port can be changed.
+The probe URL is http://localhost:3000/liveness by default. The port and the path can be changed, e.g. to use the
+readiness probe (/readiness) instead.
 Usage:
 
 	healthcheck [flags]
@@ -10,13 +11,17 @@ The flags are:
 
 	-port <1-65535>
 		Change the port where the request is sent.
+	-path <path>
+		Change the path of the probe (default: /liveness).
+	-timeout <duration>
+		Fail if there is no reply within the given time, e.g. 2s (default: 5s).
 
 Return values (exit codes):
 
 	0
 		The request was successful (HTTP 200 or HTTP 204)
 	> 0
-		The request was not successful (connection error or unexpected HTTP status code)
+		The request was not successful (connection error, timeout or unexpected HTTP status code)
 */
 package main
 
@@ -25,14 +30,19 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
 func main() {
 	var port = flag.Int("port", 3000, "HTTP port for healthcheck")
+	var path = flag.String("path", "/liveness", "HTTP path of the probe (e.g., /liveness or /readiness)")
+	var timeout = flag.Duration("timeout", 5*time.Second, "Maximum time to wait for the reply")
 
 	flag.Parse()
 
-	res, err := http.Get(fmt.Sprintf("http://localhost:%d/liveness", *port))
+	client := http.Client{Timeout: *timeout}
+	res, err := client.Get(fmt.Sprintf("http://localhost:%d/%s", *port, strings.TrimPrefix(*path, "/")))
 	if err != nil {
 		_, _ = fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
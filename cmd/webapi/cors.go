@@ -12,9 +12,11 @@ import (
 func applyCORSHandler(h http.Handler) http.Handler {
 	return handlers.CORS(
 		handlers.AllowedHeaders([]string{
-			"x-example-header",
+			"authorization",
+			"content-type",
 		}),
 		handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS", "DELETE", "PUT"}),
+		handlers.ExposedHeaders([]string{"x-request-id"}),
 		handlers.AllowedOrigins([]string{"*"}),
 	)(h)
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/metrics"
+
+	"database/sql"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+)
+
+func init() {
+	// Runtime metrics not published by the expvar package itself (which has "cmdline" and "memstats")
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+}
+
+// debugHandler returns the handler for the debug server: the debug variables (expvar) at /debug/vars, including the
+// application counters, the profiler (pprof) at /debug/pprof/, and the metrics in reg at /metrics. They must not be
+// reachable from the Internet.
+func debugHandler(reg *metrics.Registry) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", reg.Handler())
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// registerDatabaseMetrics creates the metrics of the database connection pool in reg, read from dbconn.Stats()
+func registerDatabaseMetrics(reg *metrics.Registry, dbconn *sql.DB) {
+	reg.NewGaugeFunc("webapi_db_max_open_connections", "Maximum number of open connections to the database.",
+		func() float64 { return float64(dbconn.Stats().MaxOpenConnections) })
+	reg.NewGaugeFunc("webapi_db_open_connections", "Established connections to the database, in use or idle.",
+		func() float64 { return float64(dbconn.Stats().OpenConnections) })
+	reg.NewGaugeFunc("webapi_db_in_use_connections", "Connections to the database currently in use.",
+		func() float64 { return float64(dbconn.Stats().InUse) })
+	reg.NewGaugeFunc("webapi_db_idle_connections", "Idle connections to the database.",
+		func() float64 { return float64(dbconn.Stats().Idle) })
+	reg.NewCounterFunc("webapi_db_wait_count_total", "Connections waited for, because the pool was exhausted.",
+		func() float64 { return float64(dbconn.Stats().WaitCount) })
+	reg.NewCounterFunc("webapi_db_wait_duration_seconds_total", "Time spent waiting for new connections.",
+		func() float64 { return dbconn.Stats().WaitDuration.Seconds() })
+	reg.NewCounterFunc("webapi_db_max_idle_closed_total", "Connections closed because of the idle connections limit.",
+		func() float64 { return float64(dbconn.Stats().MaxIdleClosed) })
+	reg.NewCounterFunc("webapi_db_max_idle_time_closed_total", "Connections closed because of the idle time limit.",
+		func() float64 { return float64(dbconn.Stats().MaxIdleTimeClosed) })
+	reg.NewCounterFunc("webapi_db_max_lifetime_closed_total", "Connections closed because of the lifetime limit.",
+		func() float64 { return float64(dbconn.Stats().MaxLifetimeClosed) })
+}
@@ -23,11 +23,61 @@ type WebAPIConfiguration struct {
 		ReadTimeout     time.Duration `conf:"default:5s"`
 		WriteTimeout    time.Duration `conf:"default:5s"`
 		ShutdownTimeout time.Duration `conf:"default:5s"`
+
+		// ShutdownDelay is how long the server keeps serving requests after a termination signal, with the readiness
+		// probe failing, so that load balancers stop sending requests before it stops
+		ShutdownDelay time.Duration `conf:"default:0s"`
+
+		// BehindProxy tells that the server is behind a reverse proxy, whose request IDs (X-Request-ID) are trusted
+		BehindProxy bool
 	}
 	Debug bool
-	DB    struct {
+	Log   struct {
+		// Level is the minimum level of the log entries (e.g., debug, info, warning, error); debug if Debug is set
+		Level string `conf:"default:info"`
+
+		// MethodName adds the calling function to the log entries
+		MethodName bool
+
+		// JSON writes the log entries as JSON objects, one per line
+		JSON bool
+
+		// Destination is where the log entries are written: stdout, stderr or file
+		Destination string `conf:"default:stdout"`
+
+		// File is the log file, when Destination is "file". It's reopened on SIGHUP.
+		File string
+
+		// CombinedToStdout writes the log entries to the standard output too, when Destination is "file"
+		CombinedToStdout bool
+
+		// MaxSize is the size of the log file, in bytes, that triggers its rotation (0 to disable the rotation)
+		MaxSize int64 `conf:"default:104857600"`
+
+		// MaxBackups is how many rotated files are kept, named after the log file with the suffixes ".1", ".2", and so
+		// on (0 to keep none: the log file is deleted when it's rotated)
+		MaxBackups int `conf:"default:5"`
+	}
+	DB struct {
 		Filename string `conf:"default:/tmp/decaf.db"`
 	}
+	Session struct {
+		TTL time.Duration `conf:"default:24h"`
+	}
+	User struct {
+		// NameReservation is how long a username left by a user can't be taken by others (0 to disable)
+		NameReservation time.Duration `conf:"default:168h"`
+	}
+	Blobs struct {
+		Path string `conf:"default:/tmp/decaf-blobs"`
+	}
+	Photo struct {
+		MaxSize int64 `conf:"default:10485760"`
+		Workers int   `conf:"default:2"`
+	}
+
+	// Args contains the positional arguments after flags, e.g. `migrate status`
+	Args conf.Args
 }
 
 // loadConfiguration creates a WebAPIConfiguration starting from flags, environment variables and configuration file.
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// Log destinations, for the `log.destination` configuration
+const (
+	logToStdout = "stdout"
+	logToStderr = "stderr"
+	logToFile   = "file"
+)
+
+// newLogger creates the logger as described by the `log` configuration. When logging to a file, the file is returned
+// too (nil otherwise): the caller must close it at exit. The file is reopened on SIGHUP, for logrotate.
+func newLogger(cfg WebAPIConfiguration) (*logrus.Logger, io.Closer, error) {
+	logger := logrus.New()
+
+	level, err := logrus.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid log level: %w", err)
+	}
+	if cfg.Debug {
+		level = logrus.DebugLevel
+	}
+	logger.SetLevel(level)
+	logger.SetReportCaller(cfg.Log.MethodName)
+	if cfg.Log.JSON {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	}
+
+	switch strings.ToLower(cfg.Log.Destination) {
+	case logToStdout:
+		logger.SetOutput(os.Stdout)
+		return logger, nil, nil
+	case logToStderr:
+		logger.SetOutput(os.Stderr)
+		return logger, nil, nil
+	case logToFile:
+	default:
+		return nil, nil, fmt.Errorf("invalid log destination %q (valid: stdout, stderr, file)", cfg.Log.Destination)
+	}
+
+	if cfg.Log.File == "" {
+		return nil, nil, errors.New("the log file is required when logging to a file")
+	}
+	fp, err := openRotatingFile(cfg.Log.File, cfg.Log.MaxSize, cfg.Log.MaxBackups)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Log.CombinedToStdout {
+		logger.SetOutput(io.MultiWriter(fp, os.Stdout))
+	} else {
+		logger.SetOutput(fp)
+	}
+
+	// Reopen the file on SIGHUP: logrotate moves it, and then sends the signal
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := fp.Reopen(); err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, "error reopening the log file: ", err)
+				continue
+			}
+			logger.Info("log file reopened")
+		}
+	}()
+	return logger, fp, nil
+}
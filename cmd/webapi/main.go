@@ -2,14 +2,31 @@
 Webapi is the executable for the main web server.
 It builds a web server around APIs from `service/api`.
 Webapi connects to external resources needed (database) and starts two web servers: the API web server, and the debug.
-Everything is served via the API web server, except debug variables (/debug/vars) and profiler infos (pprof).
+Everything is served via the API web server, except debug variables (/debug/vars), profiler infos (pprof) and metrics
+for Prometheus (/metrics), served by the debug web server on `web.debughost` (set it to an empty string to disable the
+debug web server). Debug variables include the application counters: requests by route and status, duration of
+database operations, and photo uploads.
+
+When `log.destination` is `file`, the log file is rotated when it grows over `log.maxsize` bytes (default 104857600,
+i.e. 100 MiB; 0 disables the rotation). The rotated files are kept as `<log.file>.1`, `<log.file>.2`, and so on, up to
+`log.maxbackups` files (default 5; 0 keeps none, so the log file is deleted when it's rotated). The log file is reopened
+on SIGHUP, for external tools like logrotate.
 
 Usage:
 
 	webapi [flags]
+	webapi [flags] migrate status|up|down
 
 Flags and configurations are handled automatically by the code in `load-configuration.go`.
 
+The API web server also serves the probes for orchestrators and load balancers: /liveness replies 200 while the
+process is serving requests, /readiness replies 200 only if the database, its schema and the blob store are working (with
+a JSON report of the checks). On SIGINT/SIGTERM, /readiness replies 503 for `web.shutdowndelay` before the server stops
+accepting connections, so that load balancers stop sending requests first.
+
+The `migrate` mode manages the database schema and exits: `status` lists the known migrations and whether they are
+applied, `up` applies all pending migrations, `down` reverts the last applied migration.
+
 Return values (exit codes):
 
 	0
@@ -19,17 +36,20 @@ Return values (exit codes):
 		The program ended due to an error
 
 Note that this program will update the schema of the database to the latest version available (embedded in the
-executable during the build).
+executable during the build). It refuses to start if the database schema is newer than that.
 */
 package main
 
 import (
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/doc"
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/blobstore"
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/globaltime"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/metrics"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/openapi"
 	"github.com/ardanlabs/conf"
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/sirupsen/logrus"
 
 	"context"
 	"database/sql"
@@ -40,6 +60,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 // main is the program entry point. The only purpose of this function is to call run() and set the exit code if there is
@@ -57,8 +78,9 @@ func main() {
 // * connects to any external resources (like databases, authenticators, etc.)
 // * creates an instance of the service/api package
 // * starts the principal web server (using the service/api.Router.Handler() for HTTP handlers)
+// * starts the debug web server
 // * waits for any termination event: SIGTERM signal (UNIX), non-recoverable server error, etc.
-// * closes the principal web server
+// * closes the principal and the debug web servers
 func run() error {
 	rand.Seed(globaltime.Now().UnixNano())
 	// Load Configuration and defaults
@@ -71,19 +93,20 @@ func run() error {
 	}
 
 	// Init logging
-	logger := logrus.New()
-	logger.SetOutput(os.Stdout)
-	if cfg.Debug {
-		logger.SetLevel(logrus.DebugLevel)
-	} else {
-		logger.SetLevel(logrus.InfoLevel)
+	logger, logFile, err := newLogger(cfg)
+	if err != nil {
+		return fmt.Errorf("configuring the logger: %w", err)
+	}
+	if logFile != nil {
+		defer func() { _ = logFile.Close() }()
 	}
 
 	logger.Infof("application initializing")
 
 	// Start Database
 	logger.Println("initializing database support")
-	dbconn, err := sql.Open("sqlite3", cfg.DB.Filename)
+	// Transactions take the write lock immediately, and concurrent writers wait for it instead of failing
+	dbconn, err := sql.Open("sqlite3", cfg.DB.Filename+"?_busy_timeout=5000&_txlock=immediate")
 	if err != nil {
 		logger.WithError(err).Error("error opening SQLite DB")
 		return fmt.Errorf("opening SQLite: %w", err)
@@ -92,12 +115,44 @@ func run() error {
 		logger.Debug("database stopping")
 		_ = dbconn.Close()
 	}()
+
+	if cfg.Args.Num(0) == "migrate" {
+		return runMigrate(dbconn, cfg.Args.Num(1), logger)
+	}
+
+	applied, err := database.MigrateUp(dbconn)
+	if err != nil {
+		logger.WithError(err).Error("error migrating the database schema")
+		return fmt.Errorf("migrating database: %w", err)
+	} else if applied > 0 {
+		logger.Infof("database schema updated, %d migrations applied", applied)
+	}
+
 	db, err := database.New(dbconn)
 	if err != nil {
 		logger.WithError(err).Error("error creating AppDatabase")
 		return fmt.Errorf("creating AppDatabase: %w", err)
 	}
 
+	// Start the blob store, where photo contents are saved
+	logger.Println("initializing blob store")
+	blobs, err := blobstore.NewFilesystem(cfg.Blobs.Path)
+	if err != nil {
+		logger.WithError(err).Error("error creating the blob store")
+		return fmt.Errorf("creating the blob store: %w", err)
+	}
+
+	// Load the API specification, used to validate requests (and responses, in debug mode)
+	spec, err := openapi.Load(doc.OpenAPI)
+	if err != nil {
+		logger.WithError(err).Error("error loading the OpenAPI specification")
+		return fmt.Errorf("loading the OpenAPI specification: %w", err)
+	}
+
+	// Metrics are exposed by the debug server at /metrics, for Prometheus
+	registry := metrics.NewRegistry()
+	registerDatabaseMetrics(registry, dbconn)
+
 	// Start (main) API server
 	logger.Info("initializing API server")
 
@@ -106,14 +161,23 @@ func run() error {
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
-	// Make a channel to listen for errors coming from the listener. Use a
-	// buffered channel so the goroutine can exit if we don't collect this error.
-	serverErrors := make(chan error, 1)
+	// Make a channel to listen for errors coming from the listeners (API and debug). Use a
+	// buffered channel so the goroutines can exit if we don't collect these errors.
+	serverErrors := make(chan error, 2)
 
 	// Create the API router
 	apirouter, err := api.New(api.Config{
-		Logger:   logger,
-		Database: db,
+		Logger:              logger,
+		Database:            db,
+		SessionTTL:          cfg.Session.TTL,
+		UsernameReservation: cfg.User.NameReservation,
+		BlobStore:           blobs,
+		MaxPhotoSize:        cfg.Photo.MaxSize,
+		PhotoWorkers:        cfg.Photo.Workers,
+		OpenAPI:             spec,
+		BehindProxy:         cfg.Web.BehindProxy,
+		Metrics:             registry,
+		ValidateResponses:   cfg.Debug,
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
@@ -146,6 +210,23 @@ func run() error {
 		logger.Infof("stopping API server")
 	}()
 
+	// Start the debug server (expvar and pprof) on its own address, not exposed like the API
+	var debugserver *http.Server
+	if cfg.Web.DebugHost != "" {
+		debugserver = &http.Server{
+			Addr:              cfg.Web.DebugHost,
+			Handler:           debugHandler(registry),
+			ReadHeaderTimeout: cfg.Web.ReadTimeout,
+		}
+		go func() {
+			logger.Infof("debug server listening on %s", debugserver.Addr)
+			if err := debugserver.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serverErrors <- fmt.Errorf("debug server: %w", err)
+			}
+			logger.Infof("stopping debug server")
+		}()
+	}
+
 	// Waiting for shutdown signal or POSIX signals
 	select {
 	case err := <-serverErrors:
@@ -155,10 +236,11 @@ func run() error {
 	case sig := <-shutdown:
 		logger.Infof("signal %v received, start shutdown", sig)
 
-		// Asking API server to shut down and load shed.
-		err := apirouter.Close()
-		if err != nil {
-			logger.WithError(err).Warning("graceful shutdown of apirouter error")
+		// Fail the readiness probe first, and give load balancers the time to notice it before closing the listener
+		apirouter.StartShutdown()
+		if cfg.Web.ShutdownDelay > 0 {
+			logger.Infof("waiting %s for load balancers to drain the server", cfg.Web.ShutdownDelay)
+			time.Sleep(cfg.Web.ShutdownDelay)
 		}
 
 		// Give outstanding requests a deadline for completion.
@@ -166,12 +248,26 @@ func run() error {
 		defer cancel()
 
 		// Asking listener to shut down and load shed.
-		err = apiserver.Shutdown(ctx)
+		err := apiserver.Shutdown(ctx)
 		if err != nil {
 			logger.WithError(err).Warning("error during graceful shutdown of HTTP server")
 			err = apiserver.Close()
 		}
 
+		// Same for the debug server (e.g., a profile being collected), within the same deadline
+		if debugserver != nil {
+			if err := debugserver.Shutdown(ctx); err != nil {
+				logger.WithError(err).Warning("error during graceful shutdown of debug server")
+				_ = debugserver.Close()
+			}
+		}
+
+		// Asking API router to shut down, after requests are completed, so background tasks queued by requests are
+		// drained too.
+		if err := apirouter.Close(); err != nil {
+			logger.WithError(err).Warning("graceful shutdown of apirouter error")
+		}
+
 		// Log the status of this shutdown.
 		switch {
 		case sig == syscall.SIGSTOP:
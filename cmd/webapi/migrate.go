@@ -0,0 +1,59 @@
+package main
+
+import (
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"github.com/sirupsen/logrus"
+
+	"database/sql"
+	"fmt"
+)
+
+// runMigrate executes the `migrate` mode. The action is one of `status`, `up` or `down`.
+func runMigrate(dbconn *sql.DB, action string, logger *logrus.Logger) error {
+	switch action {
+	case "status":
+		migrations, err := database.Migrations(dbconn)
+		if err != nil {
+			return fmt.Errorf("reading migration status: %w", err)
+		}
+		current, latest, err := database.SchemaVersion(dbconn)
+		if err != nil {
+			return fmt.Errorf("reading schema version: %w", err)
+		}
+
+		fmt.Printf("schema version %d, latest %d\n", current, latest) //nolint:forbidigo
+		for _, m := range migrations {
+			applied := "pending"
+			if !m.AppliedAt.IsZero() {
+				applied = "applied " + m.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d %-30s %s\n", m.Version, m.Name, applied) //nolint:forbidigo
+		}
+		if current > latest {
+			return database.ErrSchemaTooNew
+		}
+		return nil
+
+	case "up":
+		applied, err := database.MigrateUp(dbconn)
+		if err != nil {
+			return fmt.Errorf("migrating database: %w", err)
+		}
+		logger.Infof("%d migrations applied", applied)
+		return nil
+
+	case "down":
+		reverted, err := database.MigrateDown(dbconn)
+		if err != nil {
+			return fmt.Errorf("reverting migration: %w", err)
+		} else if !reverted {
+			logger.Info("no migration to revert")
+		} else {
+			logger.Info("last migration reverted")
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate action %q, expected status, up or down", action)
+	}
+}
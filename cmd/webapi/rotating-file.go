@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile is a log file that is rotated when it grows over maxSize bytes: the file is renamed with the suffix
+// ".1" (the previous ".1" becomes ".2", and so on, up to maxBackups files), and a new file is started. It can also be
+// reopened (e.g., on SIGHUP) when an external tool like logrotate moved it.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	fp   *os.File
+	size int64
+}
+
+// openRotatingFile opens (or creates) the log file at path, appending to it. A maxSize of zero disables the rotation.
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	f.fp = nil
+	fp, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	info, err := fp.Stat()
+	if err != nil {
+		_ = fp.Close()
+		return fmt.Errorf("reading log file size: %w", err)
+	}
+	f.fp, f.size = fp, info.Size()
+	return nil
+}
+
+// Write appends p to the file, rotating it first if p doesn't fit. An entry larger than maxSize gets a file on its own.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var rotateErr error
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		rotateErr = f.rotate()
+	}
+	if f.fp == nil {
+		// The file could not be opened again (by rotate or Reopen): retry, or drop the entry
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.fp.Write(p)
+	f.size += int64(n)
+	if err == nil {
+		// The entry is written anyway, in the file that could not be rotated
+		err = rotateErr
+	}
+	return n, err
+}
+
+// rotate renames the current file to the first backup, shifting the others, and starts a new file
+func (f *rotatingFile) rotate() error {
+	_ = f.fp.Close()
+	var err error
+	if f.maxBackups > 0 {
+		for i := f.maxBackups - 1; i >= 1; i-- {
+			// Missing backups are fine (e.g., the first rotations)
+			_ = os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+		}
+		err = os.Rename(f.path, f.path+".1")
+	} else {
+		err = os.Remove(f.path)
+	}
+
+	// The file is opened again even if it wasn't moved, to keep logging (to the same file)
+	if err := f.open(); err != nil {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("rotating log file: %w", err)
+	}
+	return nil
+}
+
+// Reopen closes and opens the file again, so that writes go to the file now at path (e.g., after logrotate renamed
+// the previous one)
+func (f *rotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fp != nil {
+		_ = f.fp.Close()
+	}
+	return f.open()
+}
+
+// Close closes the file
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fp == nil {
+		return nil
+	}
+	return f.fp.Close()
+}
@@ -0,0 +1,14 @@
+/*
+Package doc contains the API documentation. The OpenAPI specification is embedded in the executable, so that the server
+can use it at runtime (e.g., to validate requests, see the openapi package).
+*/
+package doc
+
+import (
+	_ "embed"
+)
+
+// OpenAPI is the OpenAPI specification of the API (api.yaml), in YAML
+//
+//go:embed api.yaml
+var OpenAPI []byte
@@ -1,29 +1,67 @@
 package api
 
 import (
+	"bytes"
+	"fmt"
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
 	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
 )
 
 // httpRouterHandler is the signature for functions that accepts a reqcontext.RequestContext in addition to those
 // required by the httprouter package.
 type httpRouterHandler func(http.ResponseWriter, *http.Request, httprouter.Params, reqcontext.RequestContext)
 
-// wrap parses the request and adds a reqcontext.RequestContext instance related to the request.
-func (rt *_router) wrap(fn httpRouterHandler) func(http.ResponseWriter, *http.Request, httprouter.Params) {
+// wrap parses the request and adds a reqcontext.RequestContext instance related to the request. The caller is
+// authenticated using the bearer token in the Authorization header before the handler is called. The request ID is sent
+// to the client in the X-Request-ID header, and an access log entry is written when the handler returns. The route is
+// the pattern the handler is registered with, like "/user/:user_id/photo": it labels the request in the access log and
+// in the metrics.
+func (rt *_router) wrap(route string, fn httpRouterHandler) httprouter.Handle {
+	return rt.wrapRequest(route, fn, authOwner)
+}
+
+// wrapPublic is like wrap, for handlers that don't need the caller identity (e.g., the login).
+func (rt *_router) wrapPublic(route string, fn httpRouterHandler) httprouter.Handle {
+	return rt.wrapRequest(route, fn, authNone)
+}
+
+// wrapInteraction is like wrap, for handlers where the caller acts on a resource of `:user_id`, like a photo to like
+// or to comment: the caller can be another user, and the handler checks what they are allowed to do.
+func (rt *_router) wrapInteraction(route string, fn httpRouterHandler) httprouter.Handle {
+	return rt.wrapRequest(route, fn, authCaller)
+}
+
+func (rt *_router) wrapRequest(route string, fn httpRouterHandler, auth authMode) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		reqUUID, err := uuid.NewV4()
+		// Record the reply status and size for the access log, the metrics and the request counters (and the body, if
+		// responses are validated)
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, keepBody: rt.validateResponses}
+		w = rec
+		var ctx reqcontext.RequestContext
+		rt.metrics.inFlight.Add(1)
+		defer func() {
+			rt.metrics.inFlight.Add(-1)
+			if p := recover(); p != nil {
+				rt.recoverPanic(rec, ctx, p)
+			}
+			rt.logRequest(r, route, ctx, rec, time.Since(start))
+		}()
+
+		reqUUID, err := rt.requestID(r)
 		if err != nil {
 			rt.baseLogger.WithError(err).Error("can't generate a request UUID")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		var ctx = reqcontext.RequestContext{
-			ReqUUID: reqUUID,
-		}
+		ctx.ReqUUID = reqUUID
+		w.Header().Set(requestIDHeader, reqUUID.String())
 
 		// Create a request-specific logger
 		ctx.Logger = rt.baseLogger.WithFields(logrus.Fields{
@@ -31,7 +69,115 @@ func (rt *_router) wrap(fn httpRouterHandler) func(http.ResponseWriter, *http.Re
 			"remote-ip": r.RemoteAddr,
 		})
 
+		// Resolve the caller identity, and check that it can act on the requested resource
+		if auth != authNone {
+			if err := rt.authenticate(r, ps, &ctx, auth); err != nil {
+				rt.replyError(w, ctx, err)
+				return
+			}
+		}
+
+		// Check the request against the API specification, so that handlers receive documented values only
+		if err := rt.spec.ValidateRequest(r); err != nil {
+			rt.replyError(w, ctx, err)
+			return
+		}
+
 		// Call the next handler in chain (usually, the handler function for the path)
 		fn(w, r, ps, ctx)
+		if !rt.validateResponses {
+			return
+		}
+		if violations := rt.spec.ValidateResponse(r, rec.statusCode(), rec.Header(), rec.body.Bytes()); len(violations) > 0 {
+			ctx.Logger.WithField("violations", violations).Warning("the response does not respect the API specification")
+		}
+	}
+}
+
+// requestIDHeader carries the request ID in the responses and, from a reverse proxy, in the requests
+const requestIDHeader = "X-Request-ID"
+
+// requestID returns the ID of the request: the one set by the reverse proxy in front of the server, if any and if it's
+// a UUID (only when behindProxy is set, as clients can't be trusted to send unique IDs), or a new random one.
+func (rt *_router) requestID(r *http.Request) (uuid.UUID, error) {
+	if rt.behindProxy {
+		if id, err := uuid.FromString(r.Header.Get(requestIDHeader)); err == nil && id != uuid.Nil {
+			return id, nil
+		}
+	}
+	return uuid.NewV4()
+}
+
+// recoverPanic replies with an internal error to a request whose handler panicked with value p, logging the panic with
+// its stack. If the handler already sent the headers, the reply can't be changed: the request is recorded as failed
+// anyway.
+func (rt *_router) recoverPanic(rec *responseRecorder, ctx reqcontext.RequestContext, p interface{}) {
+	if ctx.Logger == nil {
+		ctx.Logger = rt.baseLogger
+	}
+	ctx.Logger = ctx.Logger.WithField("stack", string(debug.Stack()))
+	err := fmt.Errorf("handler panicked: %v", p)
+	if rec.status == 0 {
+		rt.replyError(rec, ctx, err)
+		return
+	}
+	ctx.Logger.WithError(err).Error("request failed after the reply was sent")
+	rec.status = http.StatusInternalServerError
+}
+
+// logRequest writes the access log entry of a request, and records it in the metrics and in the request counters
+func (rt *_router) logRequest(r *http.Request, route string, ctx reqcontext.RequestContext, rec *responseRecorder, d time.Duration) {
+	rt.metrics.observeRequest(r.Method, route, rec.statusCode(), d)
+	countRequest(r.Method, route, rec.statusCode())
+
+	logger := ctx.Logger
+	if logger == nil {
+		// The request failed before its logger was created
+		logger = rt.baseLogger
+	}
+	logger.WithFields(logrus.Fields{
+		"method":      r.Method,
+		"route":       route,
+		"status":      rec.statusCode(),
+		"bytes":       rec.bytes,
+		"duration-ms": float64(d) / float64(time.Millisecond),
+		"user":        ctx.UserID,
+	}).Info("request")
+}
+
+// responseRecorder records the status and the size of a response while it's sent and, if keepBody is true, its JSON
+// body to validate it afterwards. Other bodies (e.g., photos) are not recorded.
+type responseRecorder struct {
+	http.ResponseWriter
+	status   int
+	bytes    int64
+	keepBody bool
+	body     bytes.Buffer
+}
+
+// statusCode returns the status of the response, 200 if the handler didn't write anything (as the server does)
+func (rec *responseRecorder) statusCode() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if rec.keepBody && strings.Contains(rec.Header().Get("Content-Type"), "json") {
+		rec.body.Write(b)
 	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
 }
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"github.com/julienschmidt/httprouter"
 	"net/http"
 )
 
@@ -11,33 +12,49 @@ func (rt *_router) Handler() http.Handler {
 	//rt.router.GET("/context", rt.wrap(rt.getContextReply))
 
 	// Login Tag Related
-	rt.router.POST("/session", rt.login)
-
-	// User Tag Related - using wrap to allow handling
-	rt.router.GET("/user/:user_id/get_user_profile", rt.getUserProfile)
-	rt.router.PUT("/user/:user_id/set_user_id", rt.setUserID)
-	rt.router.PUT("/user/:user_id/set_user_name", rt.setUsername)
-	rt.router.GET("/user/:user_id/get_user_stream", rt.getUserStream)
-
-	// User-Photo Interaction Related
-	rt.router.POST("user/:user_id/photo/:photo_id", rt.uploadPhoto)
-	rt.router.DELETE("user/:user_id/photo/:photo_id", rt.deletePhoto)
-
-	rt.router.PUT("/user/:user_id/photo/:photo_id/like_photo/:like_id", rt.addLike)
-	rt.router.DELETE("/user/:user_id/photo/:photo_id/like_photo/:like_id", rt.removeLike)
-
-	rt.router.POST("/user/:user_id/photo/:photo_id/comment_photo/:comment_id", rt.addComment)
-	rt.router.DELETE("/user/:user_id/photo/:photo_id/comment_photo/:comment_id", rt.removeComment)
+	rt.handle(http.MethodPost, "/session", rt.wrapPublic, rt.login)
+	rt.handle(http.MethodDelete, "/session", rt.wrap, rt.logout)
+
+	// User Tag Related - using wrap to allow handling and to authenticate the caller
+	rt.handle(http.MethodGet, "/user/:user_id/get_user_profile", rt.wrap, rt.getUserProfile)
+	rt.handle(http.MethodPut, "/user/:user_id/set_user_id", rt.wrap, rt.setUserID)
+	rt.handle(http.MethodPut, "/user/:user_id/set_user_name", rt.wrap, rt.setUsername)
+	rt.handle(http.MethodGet, "/user/:user_id/get_user_stream", rt.wrap, rt.getUserStream)
+	rt.handle(http.MethodGet, "/users", rt.wrap, rt.searchUsers)
+	rt.handle(http.MethodGet, "/search", rt.wrap, rt.searchPhotos)
+
+	// User-Photo Interaction Related - `:user_id` is the owner of the photo, while likes and comments are made by the
+	// caller
+	rt.handle(http.MethodPost, "/user/:user_id/photo", rt.wrap, rt.uploadPhoto)
+	rt.handle(http.MethodDelete, "/user/:user_id/photo/:photo_id", rt.wrap, rt.deletePhoto)
+	rt.handle(http.MethodGet, "/user/:user_id/photo/:photo_id/raw", rt.wrap, rt.getPhotoRaw)
+
+	rt.handle(http.MethodPut, "/user/:user_id/photo/:photo_id/like_photo/:like_id", rt.wrapInteraction, rt.addLike)
+	rt.handle(http.MethodDelete, "/user/:user_id/photo/:photo_id/like_photo/:like_id", rt.wrapInteraction, rt.removeLike)
+	rt.handle(http.MethodGet, "/user/:user_id/photo/:photo_id/likes", rt.wrap, rt.getPhotoLikes)
+
+	rt.handle(http.MethodPost, "/user/:user_id/photo/:photo_id/comment_photo", rt.wrapInteraction, rt.addComment)
+	rt.handle(http.MethodDelete, "/user/:user_id/photo/:photo_id/comment_photo/:comment_id", rt.wrapInteraction, rt.removeComment)
+	rt.handle(http.MethodGet, "/user/:user_id/photo/:photo_id/comments", rt.wrap, rt.getPhotoComments)
 
 	// User-User Interaction Related
-	rt.router.PUT("/user/:user_id/follow_user/:follow_id", rt.followUser)
-	rt.router.DELETE("/user/:user_id/follow_user/:follow_id", rt.unfollowUser)
+	rt.handle(http.MethodPut, "/user/:user_id/follow_user/:follow_id", rt.wrap, rt.followUser)
+	rt.handle(http.MethodDelete, "/user/:user_id/follow_user/:follow_id", rt.wrap, rt.unfollowUser)
+	rt.handle(http.MethodGet, "/user/:user_id/get_followers", rt.wrap, rt.getFollowers)
+	rt.handle(http.MethodGet, "/user/:user_id/get_following", rt.wrap, rt.getFollowing)
 
-	rt.router.PUT("/user/:user_id/ban_user/:ban_id", rt.banUser)
-	rt.router.DELETE("/user/:user_id/ban_user/:ban_id", rt.unbanUser)
+	rt.handle(http.MethodPut, "/user/:user_id/ban_user/:ban_id", rt.wrap, rt.banUser)
+	rt.handle(http.MethodDelete, "/user/:user_id/ban_user/:ban_id", rt.wrap, rt.unbanUser)
 
 	// Special routes
-	rt.router.GET("/liveness", rt.liveness)
+	rt.handle(http.MethodGet, "/liveness", rt.wrapPublic, rt.liveness)
+	rt.handle(http.MethodGet, "/readiness", rt.wrapPublic, rt.readiness)
 
 	return rt.router
 }
+
+// handle registers the handler fn for the method and the route, wrapped by wrapper (e.g., rt.wrap), which receives the
+// route too
+func (rt *_router) handle(method string, route string, wrapper func(string, httpRouterHandler) httprouter.Handle, fn httpRouterHandler) {
+	rt.router.Handle(method, route, wrapper(route, fn))
+}
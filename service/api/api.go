@@ -7,10 +7,26 @@ the Router.Handler() function that returns a handler that can be used in a http.
 
 Example:
 
+	// Load the API specification, used to validate requests
+	spec, err := openapi.Load(doc.OpenAPI)
+	if err != nil {
+		logger.WithError(err).Error("error loading the OpenAPI specification")
+		return fmt.Errorf("loading the OpenAPI specification: %w", err)
+	}
+
 	// Create the API router
 	apirouter, err := api.New(api.Config{
-		Logger:   logger,
-		Database: appdb,
+		Logger:              logger,
+		Database:            appdb,
+		SessionTTL:          cfg.Session.TTL,
+		UsernameReservation: cfg.User.NameReservation,
+		BlobStore:           blobs,
+		MaxPhotoSize:        cfg.Photo.MaxSize,
+		PhotoWorkers:        cfg.Photo.Workers,
+		OpenAPI:             spec,
+		BehindProxy:         cfg.Web.BehindProxy,
+		Metrics:             registry,
+		ValidateResponses:   cfg.Debug,
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
@@ -38,10 +54,16 @@ package api
 
 import (
 	"errors"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/blobstore"
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/metrics"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/openapi"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Config is used to provide dependencies and configuration to the New function.
@@ -51,6 +73,34 @@ type Config struct {
 
 	// Database is the instance of database.AppDatabase where data are saved
 	Database database.AppDatabase
+
+	// SessionTTL is the lifetime of session tokens issued at login
+	SessionTTL time.Duration
+
+	// UsernameReservation is how long a username left by a user can't be taken by others (zero disables it)
+	UsernameReservation time.Duration
+
+	// BlobStore is the instance of blobstore.BlobStore where photo contents are saved
+	BlobStore blobstore.BlobStore
+
+	// MaxPhotoSize is the maximum size of an uploaded photo, in bytes
+	MaxPhotoSize int64
+
+	// PhotoWorkers is the number of background workers processing photos (e.g., generating resized copies)
+	PhotoWorkers int
+
+	// OpenAPI is the API specification, used to validate the requests before calling the handlers
+	OpenAPI *openapi.Spec
+
+	// BehindProxy tells that the server is behind a reverse proxy, which sets the request IDs (X-Request-ID header)
+	BehindProxy bool
+
+	// Metrics is the registry where the API creates its metrics (requests, latencies, totals of the application)
+	Metrics *metrics.Registry
+
+	// ValidateResponses enables the validation of the responses against the specification too (useful in debug):
+	// violations are logged as warnings, and the responses are sent anyway
+	ValidateResponses bool
 }
 
 // Router is the package API interface representing an API handler builder
@@ -58,6 +108,10 @@ type Router interface {
 	// Handler returns an HTTP handler for APIs provided in this package
 	Handler() http.Handler
 
+	// StartShutdown tells that the server is shutting down: the readiness probe fails from now on, so load balancers
+	// stop sending requests, while requests are still served
+	StartShutdown()
+
 	// Close terminates any resource used in the package
 	Close() error
 }
@@ -71,6 +125,27 @@ func New(cfg Config) (Router, error) {
 	if cfg.Database == nil {
 		return nil, errors.New("database is required")
 	}
+	if cfg.SessionTTL <= 0 {
+		return nil, errors.New("session TTL must be greater than zero")
+	}
+	if cfg.UsernameReservation < 0 {
+		return nil, errors.New("username reservation can't be negative")
+	}
+	if cfg.BlobStore == nil {
+		return nil, errors.New("blob store is required")
+	}
+	if cfg.MaxPhotoSize <= 0 {
+		return nil, errors.New("max photo size must be greater than zero")
+	}
+	if cfg.PhotoWorkers <= 0 {
+		return nil, errors.New("at least one photo worker is required")
+	}
+	if cfg.OpenAPI == nil {
+		return nil, errors.New("OpenAPI specification is required")
+	}
+	if cfg.Metrics == nil {
+		return nil, errors.New("metrics registry is required")
+	}
 
 	// Create a new router where we will register HTTP endpoints. The server will pass requests to this router to be
 	// handled.
@@ -78,10 +153,21 @@ func New(cfg Config) (Router, error) {
 	router.RedirectTrailingSlash = false
 	router.RedirectFixedPath = false
 
+	db := database.Observe(cfg.Database, databaseLatency.observe)
 	return &_router{
-		router:     router,
-		baseLogger: cfg.Logger,
-		db:         cfg.Database,
+		router:              router,
+		baseLogger:          cfg.Logger,
+		db:                  db,
+		sessionTTL:          cfg.SessionTTL,
+		usernameReservation: cfg.UsernameReservation,
+		blobs:               cfg.BlobStore,
+		maxPhotoSize:        cfg.MaxPhotoSize,
+		workers:             newWorkerPool(cfg.PhotoWorkers, cfg.PhotoWorkers*photoQueuePerWorker, cfg.Logger),
+		blobWorkers:         newWorkerPool(blobDeleteWorkers, blobDeleteQueueSize, cfg.Logger),
+		spec:                cfg.OpenAPI,
+		validateResponses:   cfg.ValidateResponses,
+		behindProxy:         cfg.BehindProxy,
+		metrics:             newAPIMetrics(cfg.Metrics, db, cfg.Logger),
 	}, nil
 }
 
@@ -92,5 +178,40 @@ type _router struct {
 	// Use context logger if available (e.g., in requests) instead of this logger.
 	baseLogger logrus.FieldLogger
 
+	// db reports the duration of the operations to the debug variables
 	db database.AppDatabase
+
+	// sessionTTL is the lifetime of newly issued session tokens
+	sessionTTL time.Duration
+
+	// usernameReservation is how long a username left by a user can't be taken by others
+	usernameReservation time.Duration
+
+	blobs blobstore.BlobStore
+
+	// maxPhotoSize is the maximum size of an uploaded photo, in bytes
+	maxPhotoSize int64
+
+	// workers runs background tasks, and it's drained in Close()
+	workers *workerPool
+
+	// blobWorkers removes blobs in the background; blobDeletions counts the removals not done yet (queued, running, or
+	// waiting for a retry), and Close waits for them
+	blobWorkers   *workerPool
+	blobDeletions sync.WaitGroup
+
+	// spec validates requests, and responses too if validateResponses is true
+	spec              *openapi.Spec
+	validateResponses bool
+
+	// behindProxy trusts the request IDs in the requests
+	behindProxy bool
+
+	metrics apiMetrics
+
+	// shuttingDown is set by StartShutdown, to fail the readiness probe
+	shuttingDown atomic.Bool
 }
+
+// photoQueuePerWorker is the number of photo processing tasks that can wait for each worker
+const photoQueuePerWorker = 16
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strings"
+)
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header. It returns an empty string if the
+// header is missing or uses another scheme.
+func bearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authMode tells how the caller of a route is authenticated
+type authMode int
+
+const (
+	// authNone doesn't authenticate the caller (e.g., the login)
+	authNone authMode = iota
+	// authOwner requires the caller to be `:user_id` in mutating requests, since only the owner can modify a resource
+	authOwner
+	// authCaller accepts any caller, for requests acting on a resource of another user (e.g., liking their photo)
+	authCaller
+)
+
+// authenticate resolves the bearer token of the request to a user session, and stores the identity in the request context.
+// It returns an error if the token is missing or unknown (HTTP Status 401), or if mode is authOwner and a mutating
+// request targets a `:user_id` different from the caller (HTTP Status 403).
+func (rt *_router) authenticate(r *http.Request, ps httprouter.Params, ctx *reqcontext.RequestContext, mode authMode) error {
+	token := bearerToken(r)
+	if token == "" {
+		return errMissingToken
+	}
+
+	session, err := rt.db.GetSession(token)
+	if errors.Is(err, database.ErrSessionNotFound) {
+		ctx.Logger.Debug("authentication with an unknown or expired token")
+		return errInvalidToken
+	} else if err != nil {
+		return fmt.Errorf("can't resolve the bearer token: %w", err)
+	}
+
+	ctx.UserID = session.UserID
+	ctx.Logger = ctx.Logger.WithField("user", ctx.UserID)
+
+	// Only the owner of a resource can modify it
+	if mode == authOwner && isMutating(r.Method) && ps.ByName("user_id") != "" && ps.ByName("user_id") != ctx.UserID {
+		return errNotOwner
+	}
+	return nil
+}
+
+// isMutating reports whether the HTTP method changes the state of the resource.
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"time"
+)
+
+// Blobs that can't be removed are retried up to blobDeleteAttempts times, waiting blobDeleteBackoff before the
+// first retry, and doubling the wait at each one.
+const (
+	blobDeleteAttempts = 5
+	blobDeleteBackoff  = time.Second
+)
+
+// Blob removals have their own worker pool, so that they don't compete with the photo processing for the queue
+const (
+	blobDeleteWorkers   = 1
+	blobDeleteQueueSize = 64
+)
+
+// deleteBlobsLater removes the blobs in the background, so that requests don't wait for the blob store. Failures are
+// retried with exponential backoff; blobs that still can't be removed are logged, and left in the store. Close waits
+// for the removals, including the retries still waiting for their turn.
+func (rt *_router) deleteBlobsLater(keys []string) {
+	rt.blobDeletions.Add(1)
+	rt.scheduleBlobDeletion(keys, 1)
+}
+
+// scheduleBlobDeletion submits the removal of the blobs to the blob worker pool, as the given attempt. When the queue
+// is full, the submission is retried later, without counting it as an attempt.
+func (rt *_router) scheduleBlobDeletion(keys []string, attempt int) {
+	task := func() {
+		var failed []string
+		for _, key := range keys {
+			if err := rt.blobs.Delete(key); err != nil {
+				rt.baseLogger.WithError(err).WithField("blob", key).Warning("can't remove a blob")
+				failed = append(failed, key)
+			}
+		}
+		if len(failed) == 0 {
+			rt.blobDeletions.Done()
+			return
+		}
+		rt.retryBlobDeletion(failed, attempt)
+	}
+	if !rt.blobWorkers.submit(task) {
+		rt.baseLogger.WithField("blobs", keys).Warning("blob removal queue is full, retrying later")
+		time.AfterFunc(blobDeleteBackoff, func() { rt.scheduleBlobDeletion(keys, attempt) })
+	}
+}
+
+// retryBlobDeletion schedules the next attempt to remove the blobs, if attempt was not the last one
+func (rt *_router) retryBlobDeletion(keys []string, attempt int) {
+	if attempt >= blobDeleteAttempts {
+		for _, key := range keys {
+			rt.baseLogger.WithField("blob", key).Error("giving up removing a blob, it's left in the store")
+		}
+		rt.blobDeletions.Done()
+		return
+	}
+	delay := blobDeleteBackoff << (attempt - 1)
+	time.AfterFunc(delay, func() { rt.scheduleBlobDeletion(keys, attempt+1) })
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"expvar"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Application counters, published with the expvar package (served by the debug server at /debug/vars)
+var (
+	// requestCounters counts the requests by route and reply status, e.g. "GET /user/:user_id/get_user_profile 200"
+	requestCounters = expvar.NewMap("requests")
+
+	// uploadCounters counts the photo uploads ("accepted", "rejected") and the bytes stored ("bytes")
+	uploadCounters = expvar.NewMap("uploads")
+
+	// databaseLatency tracks the duration of the database operations
+	databaseLatency = newLatencyStats()
+)
+
+func init() {
+	expvar.Publish("database", expvar.Func(databaseLatency.snapshot))
+}
+
+// countRequest records a request for the route with the given reply status
+func countRequest(method string, route string, status int) {
+	requestCounters.Add(method+" "+route+" "+strconv.Itoa(status), 1)
+}
+
+// latencyStats collects the number of calls and the duration of operations, by operation name
+type latencyStats struct {
+	mu  sync.Mutex
+	ops map[string]*latencyStat
+}
+
+type latencyStat struct {
+	calls int64
+	total time.Duration
+	max   time.Duration
+}
+
+func newLatencyStats() *latencyStats {
+	return &latencyStats{ops: map[string]*latencyStat{}}
+}
+
+// observe records one call of op, which lasted d. It can be used as database.Observer.
+func (l *latencyStats) observe(op string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.ops[op]
+	if !ok {
+		s = &latencyStat{}
+		l.ops[op] = s
+	}
+	s.calls++
+	s.total += d
+	if d > s.max {
+		s.max = d
+	}
+}
+
+// snapshot returns the current values for expvar, with durations in milliseconds
+func (l *latencyStats) snapshot() interface{} {
+	type opStats struct {
+		Calls  int64   `json:"calls"`
+		MeanMS float64 `json:"mean_ms"`
+		MaxMS  float64 `json:"max_ms"`
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var ret = make(map[string]opStats, len(l.ops))
+	for op, s := range l.ops {
+		ret[op] = opStats{
+			Calls:  s.calls,
+			MeanMS: float64(s.total) / float64(s.calls) / float64(time.Millisecond),
+			MaxMS:  float64(s.max) / float64(time.Millisecond),
+		}
+	}
+	return ret
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/openapi"
+	"net/http"
+)
+
+// Categories of the errors detected by the API layer only, in addition to the database ones (see database.Error)
+var (
+	errUnauthorized         = errors.New("unauthorized")
+	errPayloadTooLarge      = errors.New("payload too large")
+	errUnsupportedMediaType = errors.New("unsupported media type")
+)
+
+// apiError is an error of one of the categories detected by the API layer only. Errors of the database categories are
+// database.Error values instead.
+type apiError struct {
+	kind    error
+	message string
+}
+
+// newAPIError returns an error of the given API category (e.g., errUnauthorized), with a message for the client
+func newAPIError(kind error, message string) error {
+	return &apiError{kind: kind, message: message}
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func (e *apiError) Unwrap() error {
+	return e.kind
+}
+
+// errorStatuses maps the error categories to the HTTP status and the code of the reply
+var errorStatuses = []struct {
+	kind   error
+	status int
+	code   string
+}{
+	{database.ErrValidation, http.StatusBadRequest, "invalid_request"},
+	{errUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{database.ErrForbidden, http.StatusForbidden, "forbidden"},
+	{database.ErrNotFound, http.StatusNotFound, "not_found"},
+	{database.ErrConflict, http.StatusConflict, "conflict"},
+	{errPayloadTooLarge, http.StatusRequestEntityTooLarge, "payload_too_large"},
+	{errUnsupportedMediaType, http.StatusUnsupportedMediaType, "unsupported_media_type"},
+}
+
+// Errors detected by the handlers
+var (
+	errMissingToken  = newAPIError(errUnauthorized, "the bearer token is missing")
+	errInvalidToken  = newAPIError(errUnauthorized, "the bearer token is unknown or expired")
+	errNotOwner      = database.NewError(database.ErrForbidden, "only the owner can modify this resource")
+	errMalformedBody = database.NewError(database.ErrValidation, "malformed request body")
+	errInvalidLimit  = database.NewError(database.ErrValidation, "the page limit must be between 1 and 100")
+	errEmptySearch   = database.NewError(database.ErrValidation, "the search query is empty")
+	errInvalidFlag   = database.NewError(database.ErrValidation, "boolean query parameters must be true or false")
+)
+
+// Error is the body of the replies to failed requests
+type Error struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+
+	// Violations lists the constraints of the API specification violated by the request, if any
+	Violations []openapi.Violation `json:"violations,omitempty"`
+}
+
+// replyError replies to a failed request with the HTTP status and the code matching the category of err, and the
+// message of the error. Errors without a category are internal errors: they are logged, and their message is not
+// disclosed. Handlers add context to internal errors by wrapping them, e.g., `fmt.Errorf("can't load the user: %w", err)`.
+func (rt *_router) replyError(w http.ResponseWriter, ctx reqcontext.RequestContext, err error) {
+	e := Error{
+		Code:      "internal_error",
+		Message:   "internal server error",
+		RequestID: ctx.ReqUUID.String(),
+	}
+	status := http.StatusInternalServerError
+
+	var invalid *openapi.ValidationError
+	var known *database.Error
+	var local *apiError
+	var categorized error
+	var message string
+	if errors.As(err, &invalid) {
+		status, e.Code, e.Violations = http.StatusBadRequest, "invalid_request", invalid.Violations
+		e.Message = "the request does not respect the API specification"
+	} else if errors.As(err, &known) {
+		categorized, message = known, known.Message
+	} else if errors.As(err, &local) {
+		categorized, message = local, local.message
+	}
+	for _, s := range errorStatuses {
+		if categorized != nil && errors.Is(categorized, s.kind) {
+			status, e.Code, e.Message = s.status, s.code, message
+			break
+		}
+	}
+
+	if status == http.StatusInternalServerError {
+		ctx.Logger.WithError(err).Error("request failed")
+	} else if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(e)
+}
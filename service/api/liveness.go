@@ -1,16 +1,17 @@
 package api
 
 import (
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
 )
 
-// liveness is an HTTP handler that checks the API server status. If the server cannot serve requests (e.g., some
-// resources are not ready), this should reply with HTTP Status 500. Otherwise, with HTTP Status 200
-func (rt *_router) liveness(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	/* Example of liveness check:
-	if err := rt.DB.Ping(); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}*/
+// liveness is an HTTP handler that checks the API server process status: if it replies with HTTP Status 200, the
+// process is alive and its HTTP server is handling requests. It keeps replying 200 during the shutdown, while requests
+// are drained.
+//
+// External dependencies (e.g., the database) are checked by readiness instead: when they fail, restarting the process
+// doesn't help, while a failing liveness probe usually makes the orchestrator restart it.
+func (rt *_router) liveness(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.WriteHeader(http.StatusOK)
 }
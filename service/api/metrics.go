@@ -0,0 +1,52 @@
+package api
+
+import (
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/metrics"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"time"
+)
+
+// apiMetrics are the Prometheus metrics of the API, updated by wrap for every handler
+type apiMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+	inFlight *metrics.Gauge
+}
+
+// newAPIMetrics creates the API metrics in reg, including the totals of the application, read from the database at
+// each scrape
+func newAPIMetrics(reg *metrics.Registry, db database.AppDatabase, logger logrus.FieldLogger) apiMetrics {
+	m := apiMetrics{
+		requests: reg.NewCounterVec("webapi_http_requests_total",
+			"Requests handled, by method, route and status.", "method", "route", "status"),
+		duration: reg.NewHistogramVec("webapi_http_request_duration_seconds",
+			"Time spent handling requests, by method, route and status.", metrics.DefaultBuckets,
+			"method", "route", "status"),
+		inFlight: reg.NewGauge("webapi_http_requests_in_flight", "Requests being handled."),
+	}
+
+	users := reg.NewGauge("webapi_users", "Registered users.")
+	photos := reg.NewGauge("webapi_photos", "Uploaded photos.")
+	blobBytes := reg.NewGauge("webapi_blob_bytes", "Bytes of photo contents in the blob store, resized copies included.")
+	reg.OnScrape(func() {
+		totals, err := db.GetTotals()
+		if err != nil {
+			// The previous values are exposed
+			logger.WithError(err).Warning("can't read the totals for the metrics")
+			return
+		}
+		users.Set(float64(totals.Users))
+		photos.Set(float64(totals.Photos))
+		blobBytes.Set(float64(totals.BlobBytes))
+	})
+	return m
+}
+
+// observeRequest records a request for the route, with its reply status and duration
+func (m apiMetrics) observeRequest(method string, route string, status int, d time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.Add(1, method, route, code)
+	m.duration.Observe(d.Seconds(), method, route, code)
+}
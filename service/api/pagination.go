@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	// defaultPageLimit is the number of items in a page when the `limit` query parameter is not specified
+	defaultPageLimit = 20
+
+	// maxPageLimit is the maximum number of items in a page
+	maxPageLimit = 100
+)
+
+// parsePage reads the `cursor` and `limit` query parameters of paginated lists. The cursor is opaque: it's returned
+// by the previous page, and it's validated by the database package. It returns errInvalidLimit if the limit is not
+// valid.
+func parsePage(r *http.Request) (string, int, error) {
+	query := r.URL.Query()
+
+	limit := defaultPageLimit
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return "", 0, errInvalidLimit
+		}
+	}
+	return query.Get("cursor"), limit, nil
+}
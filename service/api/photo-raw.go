@@ -0,0 +1,57 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+var errInvalidPhotoSize = database.NewError(database.ErrValidation, "unsupported photo size")
+
+// getPhotoRaw streams the content of a photo, or of one of its resized copies if the `size` query parameter is
+// specified (see photoVariantSizes). Conditional requests (If-None-Match, If-Modified-Since) and Range
+// requests are supported: the ETag is the hash of the content, and Last-Modified is the time of publishing. A photo
+// of a user that banned the caller is reported as not found.
+func (rt *_router) getPhotoRaw(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	size, ok := parsePhotoSize(r.URL.Query().Get("size"))
+	if !ok {
+		rt.replyError(w, ctx, errInvalidPhotoSize)
+		return
+	}
+
+	photo, err := rt.loadVisiblePhoto(ctx, ps.ByName("photo_id"), ps.ByName("user_id"))
+	if err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	}
+
+	// Serve the resized copy if available, the original photo otherwise (e.g., the photo is smaller than the requested
+	// size, or the copy is still being generated)
+	blobKey, contentType, hash := photo.BlobKey, photo.ContentType, photo.Hash
+	if size > 0 {
+		v, err := rt.db.GetPhotoVariant(photo.PhotoID, size)
+		if err == nil {
+			blobKey, contentType, hash = v.BlobKey, v.ContentType, v.Hash
+		} else if !errors.Is(err, database.ErrPhotoVariantNotFound) {
+			rt.replyError(w, ctx, fmt.Errorf("can't load the resized photo: %w", err))
+			return
+		}
+	}
+
+	blob, err := rt.blobs.Get(blobKey)
+	if err != nil {
+		// The content of a photo in the database is expected to be in the blob store
+		rt.replyError(w, ctx, fmt.Errorf("can't open the photo content: %w", err))
+		return
+	}
+	defer func() { _ = blob.Close() }()
+
+	// The content never changes, but the visibility does (e.g., bans): caches must revalidate every time
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hash+`"`)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	http.ServeContent(w, r, "", photo.PhotoTime, blob)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// searchPhotos replies with a page of photos whose caption or comments contain all the words in the `q` query
+// parameter, the photos of followed users first, then the most relevant first. If the `followed` query parameter is
+// true, only the photos of followed users are listed. Photos of users that banned the caller are not listed.
+func (rt *_router) searchPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	cursor, limit, err := parsePage(r)
+	if err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	} else if query == "" {
+		rt.replyError(w, ctx, errEmptySearch)
+		return
+	}
+
+	var followedOnly bool
+	if raw := r.URL.Query().Get("followed"); raw != "" {
+		followedOnly, err = strconv.ParseBool(raw)
+		if err != nil {
+			rt.replyError(w, ctx, errInvalidFlag)
+			return
+		}
+	}
+
+	results, next, err := rt.db.SearchPhotos(ctx.UserID, query, followedOnly, cursor, limit)
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't search photos: %w", err))
+		return
+	}
+
+	var l PhotoSearchResults
+	l.photoSearchResultsFromDatabase(results, next)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(l)
+}
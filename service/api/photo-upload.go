@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/imaging"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// multipartOverhead is the room left for multipart headers and boundaries when limiting the request body size
+const multipartOverhead = 64 * 1024
+
+// photoFormField and captionFormField are the names of the multipart/form-data fields carrying the photo and its
+// caption. Raw image bodies take the caption from the query parameter with the same name.
+const (
+	photoFormField   = "photo"
+	captionFormField = "caption"
+)
+
+// maxCaptionLength is the maximum length of a caption, in characters, like comments
+const maxCaptionLength = 144
+
+// allowedPhotoTypes lists the content types accepted for photos. The type is sniffed from the content, the one
+// declared by the client is not trusted.
+var allowedPhotoTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var (
+	errPhotoMissing     = database.NewError(database.ErrValidation, "the request does not contain a photo")
+	errPhotoTooLarge    = newAPIError(errPayloadTooLarge, "the photo is too large")
+	errPhotoUnsupported = newAPIError(errUnsupportedMediaType, "unsupported photo type")
+	errPhotoMalformed   = database.NewError(database.ErrValidation, "malformed photo")
+	errPhotoUnreadable  = database.NewError(database.ErrValidation, "the photo can't be read from the request")
+	errCaptionTooLong   = database.NewError(database.ErrValidation, "the caption is too long")
+)
+
+// uploadedPhoto is the content of a photo upload request
+type uploadedPhoto struct {
+	data        []byte
+	contentType string
+	caption     string
+}
+
+// readUploadedPhoto reads the photo from the request body, which is either a raw image (`image/*` content type) or a
+// `multipart/form-data` body with the image in the "photo" field and an optional "caption" field. It returns the photo
+// content, without metadata like EXIF and GPS information, its sniffed content type and its caption.
+func readUploadedPhoto(w http.ResponseWriter, r *http.Request, maxSize int64) (uploadedPhoto, error) {
+	var photo uploadedPhoto
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+multipartOverhead)
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return photo, errPhotoUnsupported
+	}
+
+	switch {
+	case mediaType == "multipart/form-data":
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return photo, errPhotoMissing
+		}
+		for {
+			part, err := mr.NextPart()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return photo, bodyError(err)
+			}
+
+			switch part.FormName() {
+			case photoFormField:
+				photo.data, err = readPhotoData(part, maxSize)
+			case captionFormField:
+				// Enough to tell whether the caption is too long, even with 4-bytes characters
+				var caption []byte
+				caption, err = io.ReadAll(io.LimitReader(part, 4*maxCaptionLength+1))
+				photo.caption = string(caption)
+			}
+			if err != nil {
+				return photo, bodyError(err)
+			}
+		}
+	case strings.HasPrefix(mediaType, "image/"):
+		photo.caption = r.URL.Query().Get(captionFormField)
+		photo.data, err = readPhotoData(r.Body, maxSize)
+		if err != nil {
+			return photo, err
+		}
+	default:
+		return photo, errPhotoUnsupported
+	}
+
+	if len(photo.data) == 0 {
+		return photo, errPhotoMissing
+	}
+	photo.caption = strings.TrimSpace(photo.caption)
+	if utf8.RuneCountInString(photo.caption) > maxCaptionLength {
+		return photo, errCaptionTooLong
+	}
+
+	photo.contentType = http.DetectContentType(photo.data)
+	if !allowedPhotoTypes[photo.contentType] {
+		return photo, errPhotoUnsupported
+	}
+
+	photo.data, err = imaging.StripMetadata(photo.data, photo.contentType)
+	if err != nil {
+		return photo, errPhotoMalformed
+	}
+	return photo, nil
+}
+
+// bodyError returns errPhotoTooLarge if err is due to the request body going over the size limit, and err otherwise
+func bodyError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return errPhotoTooLarge
+	}
+	return err
+}
+
+// readPhotoData reads the photo content from src, or returns errPhotoTooLarge if it's larger than maxSize
+func readPhotoData(src io.Reader, maxSize int64) ([]byte, error) {
+	// Read one byte more than the limit, to detect photos that are too large
+	data, err := io.ReadAll(io.LimitReader(src, maxSize+1))
+	if int64(len(data)) > maxSize {
+		return nil, errPhotoTooLarge
+	}
+	return data, bodyError(err)
+}
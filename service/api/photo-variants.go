@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/imaging"
+	"strconv"
+)
+
+// photoVariantSizes are the sizes (longest side, in pixels) of the resized copies generated for each photo, in
+// ascending order
+var photoVariantSizes = []int{150, 640, 1080}
+
+// parsePhotoSize parses the `size` query parameter of the photo retrieval. An empty value means the original photo,
+// and it's returned as 0.
+func parsePhotoSize(value string) (int, bool) {
+	if value == "" {
+		return 0, true
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	for _, s := range photoVariantSizes {
+		if s == size {
+			return size, true
+		}
+	}
+	return 0, false
+}
+
+// photoVariantKey returns the blob key of a resized copy of a photo.
+func photoVariantKey(photo database.Photo, size int) string {
+	return fmt.Sprintf("%s-%d", photo.BlobKey, size)
+}
+
+// generatePhotoVariants creates the resized copies of a photo. It runs in the worker pool: errors are logged, and the
+// original photo is served in place of any missing copy. Sizes larger than the photo itself are skipped.
+func (rt *_router) generatePhotoVariants(photo database.Photo, data []byte) {
+	logger := rt.baseLogger.WithField("photo", photo.PhotoID)
+
+	img, err := imaging.Decode(data, photo.ContentType)
+	if errors.Is(err, imaging.ErrUnsupportedFormat) {
+		logger.Debugf("no resized copies for %s photos", photo.ContentType)
+		return
+	} else if errors.Is(err, imaging.ErrTooLarge) {
+		logger.Info("the photo is too large to be resized, no resized copies")
+		return
+	} else if err != nil {
+		logger.WithError(err).Warning("can't decode the photo to resize it")
+		return
+	}
+
+	longest := img.Bounds().Dx()
+	if img.Bounds().Dy() > longest {
+		longest = img.Bounds().Dy()
+	}
+
+	for _, size := range photoVariantSizes {
+		if size >= longest {
+			break
+		}
+
+		resized := imaging.Fit(img, size)
+		var buf bytes.Buffer
+		contentType, err := imaging.Encode(&buf, resized, photo.ContentType)
+		if err != nil {
+			logger.WithError(err).Warningf("can't encode the %dpx copy", size)
+			return
+		}
+		hash := sha256.Sum256(buf.Bytes())
+
+		v := database.PhotoVariant{
+			PhotoID:     photo.PhotoID,
+			Size:        size,
+			BlobKey:     photoVariantKey(photo, size),
+			ContentType: contentType,
+			Width:       resized.Bounds().Dx(),
+			Height:      resized.Bounds().Dy(),
+			Bytes:       int64(buf.Len()),
+			Hash:        hex.EncodeToString(hash[:]),
+		}
+		if _, err := rt.blobs.Put(v.BlobKey, &buf); err != nil {
+			logger.WithError(err).Warningf("can't store the %dpx copy", size)
+			return
+		}
+		if err := rt.db.AddPhotoVariant(v, photo.BlobKey); err != nil {
+			if errors.Is(err, database.ErrPhotoNotFound) {
+				logger.Debug("photo deleted while resizing it")
+			} else {
+				logger.WithError(err).Warningf("can't save the %dpx copy", size)
+			}
+			if err := rt.blobs.Delete(v.BlobKey); err != nil {
+				logger.WithError(err).Warning("can't remove the content of a copy not saved")
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"time"
+)
+
+// readinessProbeKey is the blob written and removed by the readiness probe to check that the blob store is writable
+const readinessProbeKey = "readiness-probe"
+
+// readinessCheck is the result of one of the checks of the readiness probe
+type readinessCheck struct {
+	Name       string  `json:"name"`
+	OK         bool    `json:"ok"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// readinessReport is the reply of the readiness probe
+type readinessReport struct {
+	Ready        bool             `json:"ready"`
+	ShuttingDown bool             `json:"shutting_down"`
+	Checks       []readinessCheck `json:"checks"`
+}
+
+// readiness is an HTTP handler that checks whether the API server can serve requests: the database is reachable and
+// its schema is the expected one, and the blob store is writable. It replies with HTTP Status 200 if so, and with 503
+// otherwise, or when the server is shutting down (so load balancers stop sending requests before it stops). The body
+// is a JSON report with the result and the duration of each check.
+func (rt *_router) readiness(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	var report = readinessReport{
+		Ready:        true,
+		ShuttingDown: rt.shuttingDown.Load(),
+	}
+	for _, check := range []struct {
+		name string
+		fn   func() error
+	}{
+		{"database", rt.db.Ping},
+		{"schema", rt.db.CheckSchema},
+		{"blobstore", rt.checkBlobStore},
+	} {
+		start := time.Now()
+		err := check.fn()
+		result := readinessCheck{
+			Name:       check.name,
+			OK:         err == nil,
+			DurationMS: float64(time.Since(start)) / float64(time.Millisecond),
+		}
+		if err != nil {
+			// Probes are not authenticated, the details are in the log only
+			ctx.Logger.WithError(err).WithField("check", check.name).Warning("readiness check failed")
+			result.Error = "check failed"
+			report.Ready = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	status := http.StatusOK
+	if !report.Ready || report.ShuttingDown {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// checkBlobStore verifies that the blob store is writable, writing and removing a small blob
+func (rt *_router) checkBlobStore() error {
+	if _, err := rt.blobs.Put(readinessProbeKey, bytes.NewReader([]byte("ok"))); err != nil {
+		return fmt.Errorf("can't write to the blob store: %w", err)
+	}
+	if err := rt.blobs.Delete(readinessProbeKey); err != nil {
+		return fmt.Errorf("can't delete from the blob store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/globaltime"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+// sessionTokenBytes is the amount of random bytes in a session token
+const sessionTokenBytes = 32
+
+// newSessionToken returns a random, URL-safe session token.
+func newSessionToken() (string, error) {
+	var buf [sessionTokenBytes]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf[:]), nil
+}
+
+// login logs the user in and issues a new session token. The token must be passed in the Authorization header of
+// any other API. If the username is new, the user is registered first: in this case the reply has HTTP Status 201
+// instead of 200.
+func (rt *_router) login(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	var u User
+
+	err := json.NewDecoder(r.Body).Decode(&u)
+
+	if err != nil {
+		rt.replyError(w, ctx, errMalformedBody)
+		return
+	}
+
+	now := globaltime.Now()
+	u_db, created, err := rt.db.LoginOrRegister(u.UserName, now)
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't log the user in: %w", err))
+		return
+	}
+	u.userFromDatabase(u_db)
+
+	token, err := newSessionToken()
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't generate a session token: %w", err))
+		return
+	}
+
+	s_db := database.Session{
+		Token:     token,
+		UserID:    u.UserID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(rt.sessionTTL),
+	}
+	err = rt.db.CreateSession(s_db)
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't store the session: %w", err))
+		return
+	}
+
+	// Expired sessions are useless: take the chance to clean them up
+	if _, err := rt.db.DeleteExpiredSessions(now); err != nil {
+		ctx.Logger.WithError(err).Warning("can't delete expired sessions")
+	}
+
+	var s Session
+	s.sessionFromDatabase(s_db)
+	s.UserName = u.UserName
+
+	w.Header().Set("content-type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	_ = json.NewEncoder(w).Encode(s)
+}
+
+// logout revokes the session token used for the request.
+func (rt *_router) logout(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// A session expired in the meantime is as good as a revoked one
+	err := rt.db.RevokeSession(bearerToken(r))
+	if err != nil && !errors.Is(err, database.ErrSessionNotFound) {
+		rt.replyError(w, ctx, fmt.Errorf("can't revoke the session: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
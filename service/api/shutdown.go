@@ -1,6 +1,17 @@
 package api
 
+// StartShutdown makes the readiness probe fail, so that load balancers drain the server before it stops.
+func (rt *_router) StartShutdown() {
+	rt.shuttingDown.Store(true)
+}
+
 // Close should close everything opened in the lifecycle of the `_router`; for example, background goroutines.
 func (rt *_router) Close() error {
+	// Wait for photo processing tasks already queued
+	rt.workers.close()
+
+	// Wait for the blob removals, including the retries after a failure, then stop their workers
+	rt.blobDeletions.Wait()
+	rt.blobWorkers.close()
 	return nil
 }
@@ -2,6 +2,7 @@ package api
 
 import (
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"time"
 )
 
 // ** Main schema instance structuring **
@@ -14,23 +15,56 @@ type User struct {
 	FollowingNr int    `json:"following_nr"`
 }
 
+type UserList struct {
+	Users      []User `json:"user_array"`
+	NextCursor string `json:"next_cursor"`
+}
+
+type PhotoSearchResult struct {
+	Photo
+	Snippet string `json:"snippet"`
+}
+
+type PhotoSearchResults struct {
+	Results    []PhotoSearchResult `json:"results"`
+	NextCursor string              `json:"next_cursor"`
+}
+
+type Profile struct {
+	User
+	Photos     []Photo `json:"photos"`
+	NextCursor string  `json:"next_cursor"`
+}
+
+type Session struct {
+	Token     string    `json:"token"`
+	UserID    string    `json:"user_id"`
+	UserName  string    `json:"user_name"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 type Stream struct {
 	UserID      string  `json:"user_id"`
-	StreamID    string  `json:"stream_id"`
 	PhotoStream []Photo `json:"stream"`
+	NextCursor  string  `json:"next_cursor"`
 }
 
 type Photo struct {
-	UserID    string `json:"user_id"`
-	UserName  string `json:"user_name"`
-	PhotoID   string `json:"photo_id"`
-	PhotoData string `json:"photo_data"`
-	PhotoTime string `json:"photo_time"`
-	LikeNr    int    `json:"like_nr"`
-	Liked     bool   `json:"like"`
-	CommentNr int    `json:"comment_nr"`
+	UserID      string `json:"user_id"`
+	UserName    string `json:"user_name"`
+	PhotoID     string `json:"photo_id"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Caption     string `json:"caption"`
+	PhotoTime   string `json:"photo_time"`
+	LikeNr      int    `json:"like_nr"`
+	Liked       bool   `json:"like"`
+	CommentNr   int    `json:"comment_nr"`
 }
 
+// photoTimeLayout is the format of Photo.PhotoTime, as described in the API specification
+const photoTimeLayout = "02-01-2006 @ 15:04"
+
 type FollowAction struct {
 	UserID     string `json:"user_id"`
 	FollowedID string `json:"followed_id"`
@@ -45,18 +79,29 @@ type LikeAction struct {
 	UserID  string `json:"user_id"`
 	LikedID string `json:"liked_id"`
 	PhotoID string `json:"photo_id"`
-	LikeID  string `json:"like_id"`
 }
 
-type CommentAction struct {
-	UserID      string    `json:"user_id"`
-	CommentedID string    `json:"commented_id"`
+type Comment struct {
+	CommentID   string    `json:"comment_id"`
 	PhotoID     string    `json:"photo_id"`
-	CommentArr  []Comment `json:"comment_array"`
+	ParentID    string    `json:"parent_id"`
+	UserID      string    `json:"user_id"`
+	UserName    string    `json:"user_name"`
+	CommentBody string    `json:"content"`
+	CommentTime string    `json:"comment_time"`
+	Mentions    []Mention `json:"mentions"`
+	ReplyNr     int       `json:"reply_nr"`
+	Replies     []Comment `json:"replies"`
 }
 
-type Comment struct {
-	CommentBody string `json:"content"`
+type Mention struct {
+	UserID   string `json:"user_id"`
+	UserName string `json:"user_name"`
+}
+
+type CommentList struct {
+	Comments   []Comment `json:"comments"`
+	NextCursor string    `json:"next_cursor"`
 }
 
 // ** Main schema methods **
@@ -69,61 +114,51 @@ func (u *User) userFromDatabase(user database.User) {
 	u.FollowersNr = user.FollowersNr
 }
 
-func (u *User) userToDatabase() database.User {
-	return database.User{
-		UserID:      u.UserID,
-		UserName:    u.UserName,
-		PhotoNr:     u.PhotoNr,
-		FollowingNr: u.FollowingNr,
-		FollowersNr: u.FollowersNr,
+func (l *UserList) userListFromDatabase(users []database.User, next string) {
+	l.Users = make([]User, len(users))
+	for i := range users {
+		l.Users[i].userFromDatabase(users[i])
 	}
+	l.NextCursor = next
 }
 
-// Due to the non-convertibility of array instances, I had to drop this method
-//func (s *Stream) streamFromDatabase(stream database.Stream) {
-//	s.UserID = stream.UserID
-//	s.StreamID = stream.StreamID
-//	s.PhotoStream = stream.PhotoStream
-//}
-//
-//func (s *Stream) streamToDatabase() database.Stream {
-//	return database.Stream{
-//		UserID:      s.UserID,
-//		StreamID:    s.StreamID,
-//		PhotoStream: s.PhotoStream,
-//	}
-//
-//}
+func (l *PhotoSearchResults) photoSearchResultsFromDatabase(results []database.PhotoSearchResult, next string) {
+	l.Results = make([]PhotoSearchResult, len(results))
+	for i := range results {
+		l.Results[i].photoFromDatabase(results[i].Photo)
+		l.Results[i].Snippet = results[i].Snippet
+	}
+	l.NextCursor = next
+}
+
+func (s *Session) sessionFromDatabase(session database.Session) {
+	s.Token = session.Token
+	s.UserID = session.UserID
+	s.ExpiresAt = session.ExpiresAt
+}
+
+func (s *Stream) streamFromDatabase(stream database.Stream) {
+	s.UserID = stream.UserID
+	s.PhotoStream = make([]Photo, len(stream.PhotoStream))
+	for i := range stream.PhotoStream {
+		s.PhotoStream[i].photoFromDatabase(stream.PhotoStream[i])
+	}
+	s.NextCursor = stream.NextCursor
+}
 
 func (p *Photo) photoFromDatabase(photo database.Photo) {
 	p.UserID = photo.UserID
 	p.UserName = photo.UserName
 	p.PhotoID = photo.PhotoID
-	p.PhotoData = photo.PhotoData
-	p.PhotoTime = photo.PhotoTime
+	p.ContentType = photo.ContentType
+	p.Size = photo.Size
+	p.Caption = photo.Caption
+	p.PhotoTime = photo.PhotoTime.Format(photoTimeLayout)
 	p.LikeNr = photo.LikeNr
 	p.Liked = photo.Liked
 	p.CommentNr = photo.CommentNr
 }
 
-func (p *Photo) photoToDatabase() database.Photo {
-	return database.Photo{
-		UserID:    p.UserID,
-		UserName:  p.UserName,
-		PhotoID:   p.PhotoID,
-		PhotoData: p.PhotoData,
-		PhotoTime: p.PhotoTime,
-		LikeNr:    p.LikeNr,
-		Liked:     p.Liked,
-		CommentNr: p.CommentNr,
-	}
-}
-
-func (f *FollowAction) followActionFromDatabase(followAction database.FollowAction) {
-	f.UserID = followAction.UserID
-	f.FollowedID = followAction.FollowedID
-}
-
 func (f *FollowAction) followActionToDatabase() database.FollowAction {
 	return database.FollowAction{
 		UserID:     f.UserID,
@@ -131,11 +166,6 @@ func (f *FollowAction) followActionToDatabase() database.FollowAction {
 	}
 }
 
-func (b *BanAction) banActionFromDatabase(banAction database.BanAction) {
-	b.UserID = banAction.UserID
-	b.BannedID = banAction.BannedID
-}
-
 func (b *BanAction) banActionToDatabase() database.BanAction {
 	return database.BanAction{
 		UserID:   b.UserID,
@@ -143,45 +173,37 @@ func (b *BanAction) banActionToDatabase() database.BanAction {
 	}
 }
 
-func (l *LikeAction) likeActionFromDatabase(likeAction database.LikeAction) {
-	l.UserID = likeAction.UserID
-	l.LikedID = likeAction.LikedID
-	l.PhotoID = likeAction.PhotoID
-	l.LikeID = likeAction.LikeID
-}
-
 func (l *LikeAction) likeActionToDatabase() database.LikeAction {
 	return database.LikeAction{
 		UserID:  l.UserID,
 		LikedID: l.LikedID,
 		PhotoID: l.PhotoID,
-		LikeID:  l.LikeID,
 	}
 }
 
-// Same reasoning as per the stream.
-//func (c *CommentAction) commentActionFromDatabase(commentAction database.CommentAction) {
-//	c.UserID = commentAction.UserID
-//	c.CommentedID = commentAction.CommentedID
-//	c.PhotoID = commentAction.PhotoID
-//	c.CommentArr = commentAction.CommentArr
-//}
-//
-//func (c *CommentAction) commentActionToDatabase() database.CommentAction {
-//	return database.CommentAction{
-//		UserID:      c.UserID,
-//		CommentedID: c.CommentedID,
-//		PhotoID:     c.PhotoID,
-//		CommentArr:  c.CommentArr,
-//	}
-//}
-
-func (cb *Comment) commentFromDatabase(commentBodyAction database.Comment) {
-	cb.CommentBody = commentBodyAction.CommentBody
-}
-
-func (cb *Comment) commentToDatabase() database.Comment {
-	return database.Comment{
-		CommentBody: cb.CommentBody,
+func (c *Comment) commentFromDatabase(comment database.Comment) {
+	c.CommentID = comment.CommentID
+	c.PhotoID = comment.PhotoID
+	c.UserID = comment.UserID
+	c.UserName = comment.UserName
+	c.CommentBody = comment.CommentBody
+	c.CommentTime = comment.CommentTime.Format(photoTimeLayout)
+	c.ParentID = comment.ParentID
+	c.Mentions = make([]Mention, len(comment.Mentions))
+	for i := range comment.Mentions {
+		c.Mentions[i] = Mention(comment.Mentions[i])
+	}
+	c.ReplyNr = comment.ReplyNr
+	c.Replies = make([]Comment, len(comment.Replies))
+	for i := range comment.Replies {
+		c.Replies[i].commentFromDatabase(comment.Replies[i])
+	}
+}
+
+func (l *CommentList) commentListFromDatabase(comments []database.Comment, next string) {
+	l.Comments = make([]Comment, len(comments))
+	for i := range comments {
+		l.Comments[i].commentFromDatabase(comments[i])
 	}
+	l.NextCursor = next
 }
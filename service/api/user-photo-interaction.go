@@ -1,33 +1,296 @@
 package api
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/globaltime"
+	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
 )
 
+var (
+	errLikeNotOwned    = database.NewError(database.ErrForbidden, "users can only like photos as themselves")
+	errSelfLike        = database.NewError(database.ErrForbidden, "users can't like their own photos")
+	errCommentNotOwned = database.NewError(database.ErrForbidden, "only the author and the photo owner can delete a comment")
+)
+
 // ** Upload Action **
-func (rt *_router) uploadPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
+// uploadPhoto stores the photo in the request body in the blob store, and registers it for the user. The database
+// keeps only the metadata and the blob key. Resized copies are generated in the worker pool.
+func (rt *_router) uploadPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	photo, err := readUploadedPhoto(w, r, rt.maxPhotoSize)
+	var uploadErr *database.Error
+	var requestErr *apiError
+	if err != nil && !errors.As(err, &uploadErr) && !errors.As(err, &requestErr) {
+		// e.g., the client closed the connection, or sent a malformed multipart body
+		ctx.Logger.WithError(err).Warning("can't read the uploaded photo")
+		err = errPhotoUnreadable
+	}
+	if err != nil {
+		uploadCounters.Add("rejected", 1)
+		rt.replyError(w, ctx, err)
+		return
+	}
+
+	blobKey, err := uuid.NewV4()
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't generate a blob key: %w", err))
+		return
+	}
+	hash := sha256.Sum256(photo.data)
+
+	p_db := database.Photo{
+		UserID:      ctx.UserID,
+		BlobKey:     blobKey.String(),
+		ContentType: photo.contentType,
+		Size:        int64(len(photo.data)),
+		Hash:        hex.EncodeToString(hash[:]),
+		Caption:     photo.caption,
+		PhotoTime:   globaltime.Now(),
+	}
+	if _, err := rt.blobs.Put(p_db.BlobKey, bytes.NewReader(photo.data)); err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't store the photo content: %w", err))
+		return
+	}
+
+	p_db, err = rt.db.UploadPhoto(p_db)
+	if err != nil {
+		if err := rt.blobs.Delete(p_db.BlobKey); err != nil {
+			ctx.Logger.WithError(err).Warning("can't remove the content of a photo not saved")
+		}
+		rt.replyError(w, ctx, fmt.Errorf("can't save the photo: %w", err))
+		return
+	}
+	uploadCounters.Add("accepted", 1)
+	uploadCounters.Add("bytes", p_db.Size)
+
+	// Resized copies are generated in background: until then, the original photo is served in their place
+	if !rt.workers.submit(func() { rt.generatePhotoVariants(p_db, photo.data) }) {
+		ctx.Logger.Warning("photo processing queue is full, resized copies will not be available")
+	}
+
+	var p Photo
+	p.photoFromDatabase(p_db)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(p)
 }
 
-func (rt *_router) deletePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+// deletePhoto deletes a photo of the caller, with its likes and comments. The content of the photo and of its resized
+// copies is removed from the blob store in background. The caller is `:user_id`, as checked by the authentication.
+func (rt *_router) deletePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	photo, err := rt.loadVisiblePhoto(ctx, ps.ByName("photo_id"), ps.ByName("user_id"))
+	if err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	}
 
+	// The photo may have been deleted in the meantime
+	blobKeys, err := rt.db.DeletePhoto(photo.PhotoID)
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't delete the photo: %w", err))
+		return
+	}
+
+	rt.deleteBlobsLater(blobKeys)
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // ** Like Action **
-func (rt *_router) addLike(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
+// addLike makes the caller like the photo in the path, published by `:user_id`. Likes are identified by the photo and the user liking it, so
+// `like_id` must be the caller. Users can't like their own photos. It replies with 201 and the like, or with 204 if
+// the photo was already liked.
+func (rt *_router) addLike(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	if ps.ByName("like_id") != ctx.UserID {
+		rt.replyError(w, ctx, errLikeNotOwned)
+		return
+	}
+
+	photo, err := rt.loadVisiblePhoto(ctx, ps.ByName("photo_id"), ps.ByName("user_id"))
+	if err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	} else if photo.UserID == ctx.UserID {
+		rt.replyError(w, ctx, errSelfLike)
+		return
+	}
+
+	l := LikeAction{
+		UserID:  ctx.UserID,
+		LikedID: photo.UserID,
+		PhotoID: photo.PhotoID,
+	}
+	created, err := rt.db.AddLike(l.likeActionToDatabase())
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't like the photo: %w", err))
+		return
+	} else if !created {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(l)
+}
+
+// removeLike removes the like of the caller (the `like_id` path parameter) to the photo in the path, published by
+// `:user_id`. Removing a like that doesn't exist succeeds, so the request can be repeated safely.
+func (rt *_router) removeLike(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	if ps.ByName("like_id") != ctx.UserID {
+		rt.replyError(w, ctx, errLikeNotOwned)
+		return
+	}
+
+	photo, err := rt.loadVisiblePhoto(ctx, ps.ByName("photo_id"), ps.ByName("user_id"))
+	if err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	}
+
+	var l LikeAction
+	l.UserID = ctx.UserID
+	l.PhotoID = photo.PhotoID
+
+	if err := rt.db.RemoveLike(l.likeActionToDatabase()); err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't remove the like: %w", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (rt *_router) removeLike(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+// getPhotoLikes replies with a page of the users that liked a photo, the most recent first. Pages are selected with
+// the `cursor` and `limit` query parameters. Users that banned the caller are not listed.
+func (rt *_router) getPhotoLikes(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	cursor, limit, err := parsePage(r)
+	if err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	}
+
+	photo, err := rt.loadVisiblePhoto(ctx, ps.ByName("photo_id"), ps.ByName("user_id"))
+	if err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	}
+
+	users, next, err := rt.db.GetLikers(ctx.UserID, photo.PhotoID, cursor, limit)
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't load the likes: %w", err))
+		return
+	}
 
+	var l UserList
+	l.userListFromDatabase(users, next)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(l)
 }
 
 // ** Comment Action **
-func (rt *_router) addComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
+// addComment publishes the comment of the caller, sent in the body, to the photo in the path, published by
+// `:user_id`. The comment replies to another one if the body has its `parent_id`. It replies with 201 and the comment,
+// with the users it mentions.
+func (rt *_router) addComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	var c Comment
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		rt.replyError(w, ctx, errMalformedBody)
+		return
+	}
+
+	photo, err := rt.loadVisiblePhoto(ctx, ps.ByName("photo_id"), ps.ByName("user_id"))
+	if err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	}
+
+	c_db, err := rt.db.AddComment(database.Comment{
+		PhotoID:     photo.PhotoID,
+		ParentID:    c.ParentID,
+		UserID:      ctx.UserID,
+		CommentBody: c.CommentBody,
+		CommentTime: globaltime.Now(),
+	})
+	if err != nil {
+		// ErrCommentNotFound is about the parent comment
+		rt.replyError(w, ctx, fmt.Errorf("can't save the comment: %w", err))
+		return
+	}
+	c.commentFromDatabase(c_db)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(c)
 }
 
-func (rt *_router) removeComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+// removeComment deletes a comment to the photo in the path, published by `:user_id`, with its replies. Only the author
+// of the comment and the owner of the photo can delete it.
+func (rt *_router) removeComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	c, err := rt.db.GetComment(ps.ByName("comment_id"))
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't load the comment: %w", err))
+		return
+	} else if c.PhotoID != ps.ByName("photo_id") {
+		rt.replyError(w, ctx, database.ErrCommentNotFound)
+		return
+	}
+
+	photo, err := rt.loadVisiblePhoto(ctx, c.PhotoID, ps.ByName("user_id"))
+	if err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	} else if c.UserID != ctx.UserID && photo.UserID != ctx.UserID {
+		rt.replyError(w, ctx, errCommentNotOwned)
+		return
+	}
+
+	// The comment may have been deleted in the meantime
+	err = rt.db.RemoveComment(c.CommentID)
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't delete the comment: %w", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getPhotoComments replies with a page of the top-level comments to a photo, in chronological order, each with its
+// replies. Pages are selected with the `cursor` and `limit` query parameters. Comments of users that banned the caller
+// are not listed.
+func (rt *_router) getPhotoComments(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	cursor, limit, err := parsePage(r)
+	if err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	}
+
+	photo, err := rt.loadVisiblePhoto(ctx, ps.ByName("photo_id"), ps.ByName("user_id"))
+	if err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	}
+
+	comments, next, err := rt.db.GetComments(ctx.UserID, photo.PhotoID, cursor, limit)
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't load the comments: %w", err))
+		return
+	}
+
+	var l CommentList
+	l.commentListFromDatabase(comments, next)
 
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(l)
 }
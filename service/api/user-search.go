@@ -0,0 +1,36 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+// searchUsers replies with a page of users whose username contains the `search` query parameter. Usernames starting
+// with it are listed first. Users that banned the caller are not listed.
+func (rt *_router) searchUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	query := r.URL.Query().Get("search")
+	cursor, limit, err := parsePage(r)
+	if err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	} else if query == "" {
+		rt.replyError(w, ctx, errEmptySearch)
+		return
+	}
+
+	users, next, err := rt.db.SearchUsers(ctx.UserID, query, cursor, limit)
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't search users: %w", err))
+		return
+	}
+
+	var l UserList
+	l.userListFromDatabase(users, next)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(l)
+}
@@ -1,24 +1,155 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
 )
 
+var (
+	errSelfFollow = database.NewError(database.ErrValidation, "users can't follow themselves")
+	errSelfBan    = database.NewError(database.ErrValidation, "users can't ban themselves")
+)
+
 // ** Follow Action **
-func (rt *_router) followUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
+// followUser makes the caller follow the user in the `follow_id` path parameter, whose photos will appear in the
+// caller stream. It replies with 201 and the follow, or with 204 if the user was already followed. Users that banned
+// the caller are not found, and users banned by the caller can't be followed (see database.AppDatabase.FollowUser).
+func (rt *_router) followUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	var f FollowAction
+	f.UserID = ctx.UserID
+	f.FollowedID = ps.ByName("follow_id")
+	if f.FollowedID == ctx.UserID {
+		rt.replyError(w, ctx, errSelfFollow)
+		return
+	}
+
+	_, err := rt.db.GetUser(f.FollowedID)
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't load the user: %w", err))
+		return
+	}
+
+	// Bans are checked in the same transaction as the follow
+	created, err := rt.db.FollowUser(f.followActionToDatabase())
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't follow the user: %w", err))
+		return
+	} else if !created {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(f)
+}
+
+// unfollowUser makes the caller stop following the user in the `follow_id` path parameter. Unfollowing a user that
+// is not followed succeeds, so the request can be repeated safely.
+func (rt *_router) unfollowUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	var f FollowAction
+	f.UserID = ctx.UserID
+	f.FollowedID = ps.ByName("follow_id")
+
+	if err := rt.db.UnfollowUser(f.followActionToDatabase()); err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't unfollow the user: %w", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getFollowers replies with a page of the users following the user in the path, the most recent first
+func (rt *_router) getFollowers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.listFollows(w, r, ps, ctx, rt.db.GetFollowers)
+}
+
+// getFollowing replies with a page of the users followed by the user in the path, the most recent first
+func (rt *_router) getFollowing(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.listFollows(w, r, ps, ctx, rt.db.GetFollowing)
 }
 
-func (rt *_router) unfollowUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+// listFollows replies with the page of users returned by list for the user in the path. Pages are selected with the
+// `cursor` and `limit` query parameters. Users that banned the caller are not found, and they are not listed.
+func (rt *_router) listFollows(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext,
+	list func(viewerID string, userID string, cursor string, limit int) ([]database.User, string, error)) {
+	cursor, limit, err := parsePage(r)
+	if err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	}
+
+	u_db, err := rt.db.GetUser(ps.ByName("user_id"))
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't load the user: %w", err))
+		return
+	}
+	if err := rt.checkVisible(ctx, u_db.UserID, database.ErrUserNotFound); err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	}
+
+	users, next, err := list(ctx.UserID, u_db.UserID, cursor, limit)
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't load the follows: %w", err))
+		return
+	}
 
+	var l UserList
+	l.userListFromDatabase(users, next)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(l)
 }
 
 // ** Ban Action **
-func (rt *_router) banUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
+// banUser bans the user in the `ban_id` path parameter: from now on, they can't see anything of the caller, and the
+// follows between them are removed. It replies with 201 and the ban, or with 204 if the user was already banned.
+func (rt *_router) banUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	var b BanAction
+	b.UserID = ctx.UserID
+	b.BannedID = ps.ByName("ban_id")
+	if b.BannedID == ctx.UserID {
+		rt.replyError(w, ctx, errSelfBan)
+		return
+	}
+
+	_, err := rt.db.GetUser(b.BannedID)
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't load the user: %w", err))
+		return
+	}
+
+	created, err := rt.db.BanUser(b.banActionToDatabase())
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't ban the user: %w", err))
+		return
+	} else if !created {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(b)
 }
 
-func (rt *_router) unbanUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+// unbanUser removes the ban of the user in the `ban_id` path parameter. Removing a ban that doesn't exist succeeds,
+// so the request can be repeated safely.
+func (rt *_router) unbanUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	var b BanAction
+	b.UserID = ctx.UserID
+	b.BannedID = ps.ByName("ban_id")
 
+	if err := rt.db.UnbanUser(b.banActionToDatabase()); err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't unban the user: %w", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
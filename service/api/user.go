@@ -2,75 +2,125 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/globaltime"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
 )
 
-func (rt *_router) login(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+var (
+	errUserIDImmutable = database.NewError(database.ErrForbidden, "user identifiers can't be changed")
+	errStreamNotOwned  = database.NewError(database.ErrForbidden, "the stream is visible to its owner only")
+)
+
+// setUserID would change the identifier of the caller, but identifiers are assigned by the server at registration,
+// and they are referenced by all the user information: they can't be changed.
+func (rt *_router) setUserID(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.replyError(w, ctx, errUserIDImmutable)
+}
+
+// setUsername changes the username of the caller. The previous username is reserved to the caller for a while (see
+// Config.UsernameReservation), so that others can't impersonate them right after the change.
+func (rt *_router) setUsername(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 
 	var u User
 
 	err := json.NewDecoder(r.Body).Decode(&u)
+	if err != nil {
+		rt.replyError(w, ctx, errMalformedBody)
+		return
+	}
 
+	now := globaltime.Now()
+	u_db, err := rt.db.SetUsername(database.UsernameChange{
+		UserID:        ctx.UserID,
+		NewName:       u.UserName,
+		ChangedAt:     now,
+		ReservedUntil: now.Add(rt.usernameReservation),
+	})
 	if err != nil {
-		rt.baseLogger.WithError(err).Error("Login request failed to parse body")
-		w.WriteHeader(http.StatusBadRequest)
+		rt.replyError(w, ctx, fmt.Errorf("can't change the username: %w", err))
 		return
 	}
 
-	u_db, err := rt.db.InitSetUserID(u.userToDatabase())
 	u.userFromDatabase(u_db)
 
-	w.WriteHeader(http.StatusCreated)
-	w.Header().Set("content_type", "application/json")
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(u)
 }
 
-func (rt *_router) setUserID(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+// getUserProfile replies with the profile of a user: the user information with counters, and a page of their photos
+// in reverse chronological order (selected with the `cursor` and `limit` query parameters). Users that banned the
+// caller are not found.
+func (rt *_router) getUserProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	cursor, limit, err := parsePage(r)
+	if err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	}
 
-	var u User
+	u_db, err := rt.db.GetUser(ps.ByName("user_id"))
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't load the user: %w", err))
+		return
+	}
 
-	user_id := ps.ByName("user_id")
-	err := json.NewDecoder(r.Body).Decode(&u)
+	if err := rt.checkVisible(ctx, u_db.UserID, database.ErrUserNotFound); err != nil {
+		rt.replyError(w, ctx, err)
+		return
+	}
+
+	photos, next, err := rt.db.GetUserPhotos(ctx.UserID, u_db.UserID, cursor, limit)
 	if err != nil {
-		rt.baseLogger.WithError(err).Error("Request failed to parse user_name")
-		w.WriteHeader(http.StatusBadRequest)
+		rt.replyError(w, ctx, fmt.Errorf("can't load the user photos: %w", err))
 		return
 	}
 
-	u_db, err := rt.db.SetUserID(u.userToDatabase(), user_id)
-	u.userFromDatabase(u_db)
+	var p Profile
+	p.userFromDatabase(u_db)
+	p.Photos = make([]Photo, len(photos))
+	for i := range photos {
+		p.Photos[i].photoFromDatabase(photos[i])
+	}
+	p.NextCursor = next
 
 	w.Header().Set("content-type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	_ = json.NewEncoder(w).Encode(u)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(p)
 }
 
-func (rt *_router) setUsername(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-
-	var u User
+// getUserStream replies with a page of the stream of the caller: photos of the followed users, newest first. Pages
+// are selected with the `cursor` and `limit` query parameters.
+func (rt *_router) getUserStream(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// The stream is personal
+	if ps.ByName("user_id") != ctx.UserID {
+		rt.replyError(w, ctx, errStreamNotOwned)
+		return
+	}
 
-	user_name := ps.ByName("user_name")
-	err := json.NewDecoder(r.Body).Decode(&u)
+	cursor, limit, err := parsePage(r)
 	if err != nil {
-		rt.baseLogger.WithError(err).Error("Request failed to parse user_name")
-		w.WriteHeader(http.StatusBadRequest)
+		rt.replyError(w, ctx, err)
 		return
 	}
 
-	u_db, err := rt.db.SetUsername(u.userToDatabase(), user_name)
+	photos, next, err := rt.db.GetUserStream(ctx.UserID, cursor, limit)
+	if err != nil {
+		rt.replyError(w, ctx, fmt.Errorf("can't load the stream: %w", err))
+		return
+	}
 
-	u.userFromDatabase(u_db)
+	var s Stream
+	s.streamFromDatabase(database.Stream{
+		UserID:      ctx.UserID,
+		PhotoStream: photos,
+		NextCursor:  next,
+	})
 
 	w.Header().Set("content-type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	_ = json.NewEncoder(w).Encode(u)
-}
-
-func (rt *_router) getUserProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-
-}
-
-func (rt *_router) getUserStream(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(s)
 }
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"fmt"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+)
+
+// checkVisible applies the visibility policy (see database.AppDatabase.CanSee) to the information of ownerID. If the
+// caller can't see it, it returns hidden: it should be the "not found" error of the information, since the owner must
+// look like they don't exist.
+func (rt *_router) checkVisible(ctx reqcontext.RequestContext, ownerID string, hidden error) error {
+	visible, err := rt.db.CanSee(ctx.UserID, ownerID)
+	if err != nil {
+		return fmt.Errorf("can't check the visibility: %w", err)
+	} else if !visible {
+		return hidden
+	}
+	return nil
+}
+
+// loadVisiblePhoto loads the photo identified by photoID, if the caller can see it. If ownerID is not empty, the photo
+// must be published by that user too. Otherwise, it returns database.ErrPhotoNotFound.
+func (rt *_router) loadVisiblePhoto(ctx reqcontext.RequestContext, photoID string, ownerID string) (database.Photo, error) {
+	photo, err := rt.db.GetPhoto(photoID)
+	if err != nil {
+		return photo, fmt.Errorf("can't load the photo: %w", err)
+	} else if ownerID != "" && photo.UserID != ownerID {
+		return photo, database.ErrPhotoNotFound
+	}
+	return photo, rt.checkVisible(ctx, photo.UserID, database.ErrPhotoNotFound)
+}
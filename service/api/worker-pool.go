@@ -0,0 +1,78 @@
+package api
+
+import (
+	"github.com/sirupsen/logrus"
+	"runtime/debug"
+	"sync"
+)
+
+// workerPool runs background tasks (e.g., photo processing) on a fixed number of goroutines. Tasks wait in a bounded
+// queue: when it's full, submit fails instead of blocking the request.
+type workerPool struct {
+	tasks chan func()
+	wg    sync.WaitGroup
+
+	// logger receives the panics of the tasks
+	logger logrus.FieldLogger
+
+	// mu protects closed, so no task is submitted after the queue is closed
+	mu     sync.RWMutex
+	closed bool
+}
+
+// newWorkerPool starts a pool with the given number of workers, and a queue of queueSize tasks. A task panicking is
+// logged to logger, and the worker goes on with the next task.
+func newWorkerPool(workers int, queueSize int, logger logrus.FieldLogger) *workerPool {
+	p := &workerPool{
+		tasks:  make(chan func(), queueSize),
+		logger: logger,
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for task := range p.tasks {
+				p.run(task)
+			}
+		}()
+	}
+	return p
+}
+
+// run executes the task, recovering from its panic, if any
+func (p *workerPool) run(task func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			p.logger.WithField("panic", err).WithField("stack", string(debug.Stack())).Error("background task panicked")
+		}
+	}()
+	task()
+}
+
+// submit queues the task. It returns false if the queue is full, or if the pool is closed.
+func (p *workerPool) submit(task func()) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+
+	select {
+	case p.tasks <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops accepting new tasks, and waits for queued tasks to complete.
+func (p *workerPool) close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.tasks)
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
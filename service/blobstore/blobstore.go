@@ -0,0 +1,53 @@
+/*
+Package blobstore stores binary objects (blobs), like photos, outside the database. Blobs are identified by a key chosen
+by the caller; the database is expected to hold the key and any metadata.
+
+To use this package, create a BlobStore using one of the available implementations (e.g., NewFilesystem) and pass it to
+the packages that need it:
+
+	blobs, err := blobstore.NewFilesystem(cfg.Blobs.Path)
+	if err != nil {
+		logger.WithError(err).Error("error creating the blob store")
+		return fmt.Errorf("creating the blob store: %w", err)
+	}
+*/
+package blobstore
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when the requested blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned when a key contains characters outside [A-Za-z0-9._-], or it's empty
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore is the high level interface for the blob storage
+type BlobStore interface {
+	// Put stores the content of r under key, replacing any previous blob with the same key. The blob is visible to Get
+	// only when it has been written completely. It returns the number of bytes written.
+	Put(key string, r io.Reader) (int64, error)
+
+	// Get opens the blob identified by key. The caller must close it.
+	Get(key string) (io.ReadSeekCloser, error)
+
+	// Delete removes the blob identified by key. Removing a blob that does not exist is not an error.
+	Delete(key string) error
+}
+
+// validKey checks that the key can be safely used as a file name.
+func validKey(key string) bool {
+	if key == "" || key[0] == '.' {
+		return false
+	}
+	for _, c := range key {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package blobstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+type fsstore struct {
+	root string
+}
+
+// NewFilesystem returns a BlobStore saving blobs as files inside the directory root, which is created if needed.
+// Blobs are spread in sub-directories named after the first two characters of the key.
+func NewFilesystem(root string) (BlobStore, error) {
+	if root == "" {
+		return nil, errors.New("blob store root directory is required")
+	}
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("creating blob store directory: %w", err)
+	}
+	return &fsstore{root: root}, nil
+}
+
+func (s *fsstore) path(key string) string {
+	prefix := key
+	if len(prefix) > 2 {
+		prefix = prefix[:2]
+	}
+	return filepath.Join(s.root, prefix, key)
+}
+
+func (s *fsstore) Put(key string, r io.Reader) (int64, error) {
+	if !validKey(key) {
+		return 0, ErrInvalidKey
+	}
+	dst := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return 0, err
+	}
+
+	// Write to a temporary file first, and then move it in place: readers never see partial blobs
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".tmp-"+key+"-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		_ = tmp.Close()
+		return n, err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return n, err
+	}
+	if err = tmp.Close(); err != nil {
+		return n, err
+	}
+	return n, os.Rename(tmp.Name(), dst)
+}
+
+func (s *fsstore) Get(key string) (io.ReadSeekCloser, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+	fp, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return fp, nil
+}
+
+func (s *fsstore) Delete(key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
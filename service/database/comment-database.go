@@ -0,0 +1,324 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// commentColumns selects the comment fields. It requires comments to be aliased `c` and joined with users aliased `u`.
+const commentColumns = `c.comment_id, c.photo_id, COALESCE(c.parent_id, ''), c.user_id, u.user_name, c.comment_body,
+		c.comment_time`
+
+// mentionPattern matches the "@username" mentions in a comment. Usernames have no character restrictions, so a
+// mention ends at the first space, and the punctuation that usually follows a word is trimmed (see parseMentions).
+var mentionPattern = regexp.MustCompile(`@([^\s@]+)`)
+
+// validCommentBody checks the comment length rule from the API specification (1 to 144 characters)
+func validCommentBody(body string) bool {
+	n := utf8.RuneCountInString(strings.TrimSpace(body))
+	return n >= 1 && n <= 144
+}
+
+// parseMentions returns the usernames mentioned in a comment body, without duplicates
+func parseMentions(body string) []string {
+	var names []string
+	var seen = map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		name, ok := normalizeUsername(strings.TrimRight(m[1], `.,;:!?)]}"'`))
+		if ok && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+	return names
+}
+
+// AddComment saves the comment c.CommentBody of c.UserID to the photo c.PhotoID, published at c.CommentTime. If
+// c.ParentID is set, the comment replies to that comment, or to its parent if it's a reply itself (there is one level
+// of threading only); the parent must be a comment to the same photo, visible to the author, otherwise
+// ErrCommentNotFound is returned. The users mentioned in the body are resolved and saved, except those that banned
+// the author.
+//
+// The comment identifier is taken from the "comments" sequence, so it's never reused after a deletion, and it's
+// returned with the author username and the mentions. It returns ErrInvalidComment if the body is empty or too long.
+func (db *appdbimpl) AddComment(c Comment) (Comment, error) {
+	c.CommentBody = strings.TrimSpace(c.CommentBody)
+	if !validCommentBody(c.CommentBody) {
+		return c, ErrInvalidComment
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return c, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if c.ParentID != "" {
+		var grandparentID string
+		err = tx.QueryRow(`SELECT COALESCE(parent_id, '') FROM comments
+				WHERE comment_id = ? AND photo_id = ? AND `+visibleOwner("user_id"),
+			c.ParentID, c.PhotoID, c.UserID).Scan(&grandparentID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c, ErrCommentNotFound
+		} else if err != nil {
+			return c, err
+		}
+		if grandparentID != "" {
+			c.ParentID = grandparentID
+		}
+	}
+
+	c.CommentID, err = nextID(tx, "comments", "Comment")
+	if err != nil {
+		return c, err
+	}
+	_, err = tx.Exec(`INSERT INTO comments (comment_id, photo_id, parent_id, user_id, comment_body, comment_time)
+			VALUES (?, ?, NULLIF(?, ''), ?, ?, ?)`,
+		c.CommentID, c.PhotoID, c.ParentID, c.UserID, c.CommentBody, c.CommentTime.Unix())
+	if err != nil {
+		return c, err
+	}
+
+	for _, name := range parseMentions(c.CommentBody) {
+		_, err = tx.Exec(`INSERT INTO mentions (comment_id, user_id)
+				SELECT ?, user_id FROM users WHERE user_name = ? COLLATE NOCASE AND `+visibleOwner("user_id")+`
+				ON CONFLICT DO NOTHING`, c.CommentID, name, c.UserID)
+		if err != nil {
+			return c, err
+		}
+	}
+
+	err = tx.QueryRow(`SELECT user_name FROM users WHERE user_id = ?`, c.UserID).Scan(&c.UserName)
+	if err != nil {
+		return c, err
+	}
+	c.CommentTime = time.Unix(c.CommentTime.Unix(), 0).UTC()
+	c.Replies = []Comment{}
+
+	if err := tx.Commit(); err != nil {
+		return c, err
+	}
+
+	err = db.loadMentions(map[string]*Comment{c.CommentID: &c}, []any{c.CommentID})
+	return c, err
+}
+
+// GetComment returns the comment identified by commentID, or ErrCommentNotFound if there is no such comment. Its
+// mentions and replies are not loaded.
+func (db *appdbimpl) GetComment(commentID string) (Comment, error) {
+	var c Comment
+	var commentTime int64
+
+	err := db.c.QueryRow(`SELECT `+commentColumns+`
+			FROM comments c INNER JOIN users u ON u.user_id = c.user_id
+			WHERE c.comment_id = ?`, commentID).Scan(
+		&c.CommentID, &c.PhotoID, &c.ParentID, &c.UserID, &c.UserName, &c.CommentBody, &commentTime)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c, ErrCommentNotFound
+	} else if err != nil {
+		return c, err
+	}
+	c.CommentTime = time.Unix(commentTime, 0).UTC()
+	return c, nil
+}
+
+// RemoveComment deletes the comment identified by commentID with its replies and mentions, or returns
+// ErrCommentNotFound if there is no such comment.
+func (db *appdbimpl) RemoveComment(commentID string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(`DELETE FROM mentions WHERE comment_id IN (
+				SELECT comment_id FROM comments WHERE comment_id = ? OR parent_id = ?
+			)`, commentID, commentID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM comments WHERE parent_id = ?`, commentID)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`DELETE FROM comments WHERE comment_id = ?`, commentID)
+	if err != nil {
+		return err
+	}
+	rows_aff, err := res.RowsAffected()
+	if err != nil {
+		return err
+	} else if rows_aff == 0 {
+		return ErrCommentNotFound
+	}
+
+	return tx.Commit()
+}
+
+// GetComments returns a page of the top-level comments to photoID, in chronological order, each with its replies in
+// chronological order and their number. Comments of users that banned viewerID are excluded, with their replies.
+func (db *appdbimpl) GetComments(viewerID string, photoID string, cursor string, limit int) ([]Comment, string, error) {
+	fields, err := decodeCursor(cursor, 2)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Comments published in the same second are sorted by row ID
+	var after = "true"
+	var afterArgs []any
+	if fields != nil {
+		commentTime, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		rowid, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		after = "(c.comment_time, c.rowid) > (?, ?)"
+		afterArgs = []any{commentTime, rowid}
+	}
+
+	args := append([]any{photoID, viewerID}, afterArgs...)
+	rows, err := db.c.Query(`SELECT `+commentColumns+`, c.rowid
+			FROM comments c INNER JOIN users u ON u.user_id = c.user_id
+			WHERE c.photo_id = ? AND c.parent_id IS NULL
+				AND `+visibleOwner("c.user_id")+`
+				AND `+after+`
+			ORDER BY c.comment_time, c.rowid
+			LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var comments = []Comment{}
+	var next string
+	var lastRowID int64
+	for rows.Next() {
+		var c Comment
+		rowid, err := scanCommentRow(rows, &c)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(comments) == limit {
+			last := comments[len(comments)-1]
+			next = encodeCursor(strconv.FormatInt(last.CommentTime.Unix(), 10), strconv.FormatInt(lastRowID, 10))
+			break
+		}
+		comments = append(comments, c)
+		lastRowID = rowid
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	_ = rows.Close()
+
+	if err := db.loadReplies(viewerID, comments); err != nil {
+		return nil, "", err
+	}
+	return comments, next, nil
+}
+
+// scanCommentRow reads the current row, selected with commentColumns followed by the row ID, into c. It returns the
+// row ID of the comment.
+func scanCommentRow(rows *sql.Rows, c *Comment) (int64, error) {
+	var commentTime, rowid int64
+	err := rows.Scan(&c.CommentID, &c.PhotoID, &c.ParentID, &c.UserID, &c.UserName, &c.CommentBody, &commentTime, &rowid)
+	c.CommentTime = time.Unix(commentTime, 0).UTC()
+	return rowid, err
+}
+
+// inPlaceholders returns the placeholders for an `IN (...)` condition with n values
+func inPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// loadReplies fills the replies visible to viewerID, and their number, of the top-level comments. The mentions of all
+// these comments are loaded too.
+func (db *appdbimpl) loadReplies(viewerID string, comments []Comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	var parentIDs []any
+	var parents = map[string]*Comment{}
+	for i := range comments {
+		comments[i].Replies = []Comment{}
+		parentIDs = append(parentIDs, comments[i].CommentID)
+		parents[comments[i].CommentID] = &comments[i]
+	}
+
+	rows, err := db.c.Query(`SELECT `+commentColumns+`, c.rowid
+			FROM comments c INNER JOIN users u ON u.user_id = c.user_id
+			WHERE c.parent_id IN (`+inPlaceholders(len(parentIDs))+`)
+				AND `+visibleOwner("c.user_id")+`
+			ORDER BY c.comment_time, c.rowid`, append(parentIDs, viewerID)...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var c Comment
+		if _, err := scanCommentRow(rows, &c); err != nil {
+			return err
+		}
+		parent := parents[c.ParentID]
+		parent.Replies = append(parent.Replies, c)
+		parent.ReplyNr++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_ = rows.Close()
+
+	// The replies are complete now, so they can be referenced
+	var all = map[string]*Comment{}
+	for i := range comments {
+		all[comments[i].CommentID] = &comments[i]
+		for j := range comments[i].Replies {
+			all[comments[i].Replies[j].CommentID] = &comments[i].Replies[j]
+		}
+	}
+	return db.loadMentions(all, parentIDs)
+}
+
+// loadMentions fills the mentions of the comments, indexed by ID. They are the top-level comments in threadIDs and
+// (some of) their replies.
+func (db *appdbimpl) loadMentions(comments map[string]*Comment, threadIDs []any) error {
+	for _, c := range comments {
+		c.Mentions = []Mention{}
+	}
+
+	in := inPlaceholders(len(threadIDs))
+	rows, err := db.c.Query(`SELECT m.comment_id, u.user_id, u.user_name
+			FROM mentions m
+				INNER JOIN comments c ON c.comment_id = m.comment_id
+				INNER JOIN users u ON u.user_id = m.user_id
+			WHERE c.comment_id IN (`+in+`) OR c.parent_id IN (`+in+`)
+			ORDER BY m.rowid`, append(threadIDs, threadIDs...)...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var commentID string
+		var m Mention
+		if err := rows.Scan(&commentID, &m.UserID, &m.UserName); err != nil {
+			return err
+		}
+		if c, ok := comments[commentID]; ok {
+			c.Mentions = append(c.Mentions, m)
+		}
+	}
+	return rows.Err()
+}
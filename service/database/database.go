@@ -25,8 +25,17 @@ This is an example on how to migrate the DB and connect to it:
 		logger.Debug("database stopping")
 		_ = db.Close()
 	}()
+	applied, err := database.MigrateUp(db)
+	if err != nil {
+		logger.WithError(err).Error("error migrating the database schema")
+		return fmt.Errorf("migrating database: %w", err)
+	}
 
-Then you can initialize the AppDatabase and pass it to the api package.
+Then you can initialize the AppDatabase and pass it to the api package. New refuses databases whose schema is not at the
+latest version.
+
+Migrations are SQL files embedded from the `migrations/` directory (see migrate.go). The version of the schema is stored
+in the `schema_version` table.
 */
 package database
 
@@ -34,6 +43,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 )
 
 type User struct {
@@ -44,21 +54,58 @@ type User struct {
 	FollowingNr int    `json:"following_nr"`
 }
 
+type Session struct {
+	Token     string    `json:"token"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 type Stream struct {
 	UserID      string  `json:"user_id"`
-	StreamID    string  `json:"stream_id"`
 	PhotoStream []Photo `json:"stream"`
+	NextCursor  string  `json:"next_cursor"`
 }
 
 type Photo struct {
-	UserID    string `json:"user_id"`
-	UserName  string `json:"user_name"`
-	PhotoID   string `json:"photo_id"`
-	PhotoData string `json:"photo_data"`
-	PhotoTime string `json:"photo_time"`
-	LikeNr    int    `json:"like_nr"`
-	Liked     bool   `json:"like"`
-	CommentNr int    `json:"comment_nr"`
+	UserID      string    `json:"user_id"`
+	UserName    string    `json:"user_name"`
+	PhotoID     string    `json:"photo_id"`
+	BlobKey     string    `json:"blob_key"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Hash        string    `json:"hash"`
+	Caption     string    `json:"caption"`
+	PhotoTime   time.Time `json:"photo_time"`
+	LikeNr      int       `json:"like_nr"`
+	Liked       bool      `json:"like"`
+	CommentNr   int       `json:"comment_nr"`
+}
+
+// PhotoSearchResult is a photo matching a full-text search, with an excerpt of the matching caption or comment
+type PhotoSearchResult struct {
+	Photo
+	Snippet string `json:"snippet"`
+}
+
+type PhotoVariant struct {
+	PhotoID     string `json:"photo_id"`
+	Size        int    `json:"size"`
+	BlobKey     string `json:"blob_key"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Bytes       int64  `json:"bytes"`
+	Hash        string `json:"hash"`
+}
+
+// UsernameChange is the change of the username of UserID to NewName, at ChangedAt. The previous username is reserved to
+// UserID until ReservedUntil.
+type UsernameChange struct {
+	UserID        string    `json:"user_id"`
+	NewName       string    `json:"user_name"`
+	ChangedAt     time.Time `json:"changed_at"`
+	ReservedUntil time.Time `json:"reserved_until"`
 }
 
 type FollowAction struct {
@@ -71,51 +118,147 @@ type BanAction struct {
 	BannedID string `json:"banned_id"`
 }
 
+// LikeAction is the like of UserID to the photo PhotoID, published by LikedID
 type LikeAction struct {
 	UserID  string `json:"user_id"`
 	LikedID string `json:"liked_id"`
 	PhotoID string `json:"photo_id"`
-	LikeID  string `json:"like_id"`
 }
 
-type CommentAction struct {
-	UserID      string    `json:"user_id"`
-	CommentedID string    `json:"commented_id"`
+// Comment is a comment of UserID to the photo PhotoID. Replies have the top-level comment they reply to in ParentID;
+// when listed, top-level comments carry their replies.
+type Comment struct {
+	CommentID   string    `json:"comment_id"`
 	PhotoID     string    `json:"photo_id"`
-	CommentArr  []Comment `json:"comment_array"`
+	ParentID    string    `json:"parent_id"`
+	UserID      string    `json:"user_id"`
+	UserName    string    `json:"user_name"`
+	CommentBody string    `json:"content"`
+	CommentTime time.Time `json:"comment_time"`
+	Mentions    []Mention `json:"mentions"`
+	ReplyNr     int       `json:"reply_nr"`
+	Replies     []Comment `json:"replies"`
 }
 
-type Comment struct {
-	CommentBody string `json:"content"`
+// Mention is a user mentioned in a comment
+type Mention struct {
+	UserID   string `json:"user_id"`
+	UserName string `json:"user_name"`
 }
 
+// Errors returned for failed requests, like ErrUserNotFound, are of one of these categories, which tell callers how to
+// report them (e.g., which HTTP status): errors.Is(ErrUserNotFound, ErrNotFound) is true.
+var (
+	// ErrNotFound is the category of errors about entities that don't exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is the category of errors about changes conflicting with the current state
+	ErrConflict = errors.New("conflict")
+
+	// ErrForbidden is the category of errors about actions that the user is not allowed to do
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrValidation is the category of errors about invalid input
+	ErrValidation = errors.New("validation failed")
+)
+
+// Error is an error of the category Kind, with its own message. It matches both itself and its category in errors.Is.
+type Error struct {
+	Kind    error
+	Message string
+}
+
+// NewError returns a new error of the given category
+func NewError(kind error, message string) error {
+	return &Error{Kind: kind, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// ErrUserNotFound is returned when the requested user does not exist
+var ErrUserNotFound = NewError(ErrNotFound, "user not found")
+
+// ErrInvalidUsername is returned when a username does not respect the username rules (see normalizeUsername)
+var ErrInvalidUsername = NewError(ErrValidation,
+	"username must be between 3 and 15 characters long, without the spaces around it, and without control characters")
+
+// ErrUsernameTaken is returned when a username is already used by another user
+var ErrUsernameTaken = NewError(ErrConflict, "username already taken")
+
+// ErrUsernameReserved is returned when a username has been left by another user recently, and it's still reserved
+var ErrUsernameReserved = NewError(ErrConflict, "username reserved")
+
+// ErrFollowBanned is returned when a user tries to follow a user they banned
+var ErrFollowBanned = NewError(ErrForbidden, "users can't follow a user they banned")
+
+// ErrPhotoNotFound is returned when the requested photo does not exist
+var ErrPhotoNotFound = NewError(ErrNotFound, "photo not found")
+
+// ErrPhotoVariantNotFound is returned when the requested size of a photo has not been generated
+var ErrPhotoVariantNotFound = NewError(ErrNotFound, "photo variant not found")
+
+// ErrCommentNotFound is returned when the requested comment does not exist
+var ErrCommentNotFound = NewError(ErrNotFound, "comment not found")
+
+// ErrInvalidComment is returned when a comment body does not respect the length limits
+var ErrInvalidComment = NewError(ErrValidation, "comment must be between 1 and 144 characters long")
+
+// ErrSessionNotFound is returned when a session token is unknown, revoked or expired
+var ErrSessionNotFound = NewError(ErrNotFound, "session not found")
+
 // AppDatabase is the high level interface for the DB - specification of [A-a] naming pattern
 type AppDatabase interface {
 
+	// Session Related
+	CreateSession(s Session) error
+	GetSession(token string) (Session, error)
+	RevokeSession(token string) error
+	DeleteExpiredSessions(now time.Time) (int64, error)
+
 	// User Tag Related
-	InitSetUserID(u User) (User, error)
-	SetUserID(u User, s string) (User, error)
-	SetUsername(u User, s string) (User, error)
-	GetUserStream(u User) ([]Photo, error)
-	//GetFollowers(u User) (int, error)
-	//GetFollowing(u User) (int, error)
+	GetUser(userID string) (User, error)
+	LoginOrRegister(username string, now time.Time) (User, bool, error)
+	SetUsername(c UsernameChange) (User, error)
+	GetUserStream(userID string, cursor string, limit int) ([]Photo, string, error)
+	GetUserPhotos(viewerID string, userID string, cursor string, limit int) ([]Photo, string, error)
+	SearchUsers(searcherID string, query string, cursor string, limit int) ([]User, string, error)
+	SearchPhotos(viewerID string, query string, followedOnly bool, cursor string, limit int) ([]PhotoSearchResult, string, error)
 
 	// User-Photo Interaction Related
+	GetPhoto(photoID string) (Photo, error)
 	UploadPhoto(p Photo) (Photo, error)
-	DeletePhoto(s string) error
+	AddPhotoVariant(v PhotoVariant, photoBlobKey string) error
+	GetPhotoVariant(photoID string, size int) (PhotoVariant, error)
+	DeletePhoto(photoID string) ([]string, error)
 
-	AddLike(l LikeAction) (LikeAction, error)
+	AddLike(l LikeAction) (bool, error)
 	RemoveLike(l LikeAction) error
+	GetLikers(viewerID string, photoID string, cursor string, limit int) ([]User, string, error)
 
-	AddComment(c CommentAction) (CommentAction, error)
-	RemoveComment(s string) error
+	AddComment(c Comment) (Comment, error)
+	GetComment(commentID string) (Comment, error)
+	RemoveComment(commentID string) error
+	GetComments(viewerID string, photoID string, cursor string, limit int) ([]Comment, string, error)
 
 	// User-User Interaction Related
-	FollowUser(f FollowAction) (FollowAction, error)
+	FollowUser(f FollowAction) (bool, error)
 	UnfollowUser(f FollowAction) error
+	GetFollowers(viewerID string, userID string, cursor string, limit int) ([]User, string, error)
+	GetFollowing(viewerID string, userID string, cursor string, limit int) ([]User, string, error)
 
-	BanUser(b BanAction) (BanAction, error)
+	BanUser(b BanAction) (bool, error)
 	UnbanUser(b BanAction) error
+	CanSee(viewerID string, ownerID string) (bool, error)
+
+	// Monitoring Related
+	GetTotals() (Totals, error)
+	CheckSchema() error
 
 	Ping() error
 }
@@ -131,92 +274,12 @@ func New(db *sql.DB) (AppDatabase, error) {
 		return nil, errors.New("database is required when building a AppDatabase")
 	}
 
-	// Check if table exists. If not, the database is empty, and we need to create the structure
-	var table string
-
-	err := db.QueryRow(`SELECT * FROM sqlite_master WHERE type='table' AND name='users';`).Scan(&table)
-	if errors.Is(err, sql.ErrNoRows) {
-		userDB := `CREATE TABLE users (
-						user_id VARCHAR(20) NOT NULL PRIMARY KEY AUTOINCREMENT,
-						user_name VARCHAR(55) NOT NULL UNIQUE,
-						photo_nr INTEGER NOT NULL,
-						followers_nr INTEGER NOT NULL,
-						following_nr INTEGER NOT NULL
-					);`
-		_, err = db.Exec(userDB)
-		if err != nil {
-			return nil, fmt.Errorf("error creating database structure: %w", err)
-		}
+	// The schema must be exactly the one described by the embedded migrations, and usable by this build
+	if err := checkFTS5(db); err != nil {
+		return nil, err
 	}
-
-	err = db.QueryRow(`SELECT * FROM sqlite_master WHERE type='table' AND name='photos';`).Scan(&table)
-	if errors.Is(err, sql.ErrNoRows) {
-		photoDB := `CREATE TABLE photos (
-    					user_id VARCHAR(20) NOT NULL,
-    					user_name VARCHAR(55) NOT NULL UNIQUE,
-						photo_id VARCHAR(20) NOT NULL PRIMARY KEY,
-						photo_data VARCHAR(255),
-						photo_time DATE TIME,
-						like_nr INTEGER,
-						comment_nr INTEGER,
-                    	FOREIGN KEY (user_id) REFERENCES users(user_id)
-					);`
-		_, err = db.Exec(photoDB)
-		if err != nil {
-			return nil, fmt.Errorf("error creating database structure: %w", err)
-		}
-	}
-
-	err = db.QueryRow(`SELECT * FROM sqlite_master WHERE type='table' AND name='follows';`).Scan(&table)
-	if errors.Is(err, sql.ErrNoRows) {
-		followsDB := `CREATE TABLE follows (
-						user_id VARCHAR(20) NOT NULL PRIMARY KEY,
-						followed_id VARCHAR(20) NOT NULL PRIMARY KEY
-					);`
-		_, err = db.Exec(followsDB)
-		if err != nil {
-			return nil, fmt.Errorf("error creating database structure: %w", err)
-		}
-	}
-
-	err = db.QueryRow(`SELECT * FROM sqlite_master WHERE type='table' AND name='bans';`).Scan(&table)
-	if errors.Is(err, sql.ErrNoRows) {
-		bansDB := `CREATE TABLE bans (
-						user_id VARCHAR(20) NOT NULL PRIMARY KEY,
-						banned_id VARCHAR(20) NOT NULL PRIMARY KEY
-					);`
-		_, err = db.Exec(bansDB)
-		if err != nil {
-			return nil, fmt.Errorf("error creating database structure: %w", err)
-		}
-	}
-
-	err = db.QueryRow(`SELECT * FROM sqlite_master WHERE type='table' AND name='likes';`).Scan(&table)
-	if errors.Is(err, sql.ErrNoRows) {
-		likesDB := `CREATE TABLE likes (
-						user_id VARCHAR(20) NOT NULL PRIMARY KEY,
-						liked_id VARCHAR(20) NOT NULL,
-						photo_id VARCHAR(20) NOT NULL PRIMARY KEY,
-						like_id VARCHAR(20) NOT NULL
-					);`
-		_, err = db.Exec(likesDB)
-		if err != nil {
-			return nil, fmt.Errorf("error creating database structure: %w", err)
-		}
-	}
-
-	err = db.QueryRow(`SELECT * FROM sqlite_master WHERE type='table' AND name='comments';`).Scan(&table)
-	if errors.Is(err, sql.ErrNoRows) {
-		commentsDB := `CREATE TABLE comments (
-						user_id VARCHAR(20) NOT NULL PRIMARY KEY,
-						commented_id VARCHAR(20) NOT NULL,
-						photo_id VARCHAR(20) NOT NULL PRIMARY KEY,
-						comment_body TEXT NOT NULL
-					);`
-		_, err = db.Exec(commentsDB)
-		if err != nil {
-			return nil, fmt.Errorf("error creating database structure: %w", err)
-		}
+	if err := checkSchema(db); err != nil {
+		return nil, err
 	}
 
 	return &appdbimpl{
@@ -224,6 +287,27 @@ func New(db *sql.DB) (AppDatabase, error) {
 	}, nil
 }
 
+// checkSchema returns ErrSchemaOutdated or ErrSchemaTooNew if the database schema is not the one described by the
+// embedded migrations
+func checkSchema(db *sql.DB) error {
+	current, latest, err := SchemaVersion(db)
+	if err != nil {
+		return fmt.Errorf("checking database schema: %w", err)
+	}
+	if current > latest {
+		return fmt.Errorf("%w (database: %d, latest: %d)", ErrSchemaTooNew, current, latest)
+	} else if current < latest {
+		return fmt.Errorf("%w (database: %d, latest: %d)", ErrSchemaOutdated, current, latest)
+	}
+	return nil
+}
+
 func (db *appdbimpl) Ping() error {
 	return db.c.Ping()
 }
+
+// CheckSchema verifies that the database schema is still the one this program was started with (e.g., no migration
+// was applied or reverted by another program meanwhile)
+func (db *appdbimpl) CheckSchema() error {
+	return checkSchema(db.c)
+}
@@ -0,0 +1,313 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/globaltime"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles contains the schema migrations. Each migration is made of two files, named
+// `<version>_<name>.up.sql` and `<version>_<name>.down.sql`, where version is a positive integer. Migrations are
+// applied in version order; never change a migration that has been released, add a new one instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// ErrSchemaTooNew is returned when the database has been migrated by a newer version of this program
+var ErrSchemaTooNew = errors.New("database schema is newer than the latest known migration")
+
+// ErrSchemaOutdated is returned when the database has pending migrations
+var ErrSchemaOutdated = errors.New("database schema is not up to date, migrations are pending")
+
+// ErrUnversionedSchema is returned when a database without migrations applied already has tables, e.g. because it was
+// created before the migration engine was introduced: its tables can't be trusted to match the initial migration
+var ErrUnversionedSchema = errors.New("database has tables but no migrations applied, " +
+	"it must be migrated manually or replaced with an empty database")
+
+// ErrFTS5Unavailable is returned when SQLite has been built without the FTS5 extension, which the schema requires
+var ErrFTS5Unavailable = errors.New("the SQLite FTS5 extension is not available, build with `-tags sqlite_fts5`")
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus describes a migration known by this program. AppliedAt is the zero time if the migration has not
+// been applied to the database.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+// loadMigrations parses the embedded migration files, sorted by version.
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("reading embedded migrations: %w", err)
+	}
+
+	var byVersion = map[int]*migration{}
+	for _, entry := range entries {
+		filename := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(filename, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %q: name must end with .up.sql or .down.sql", filename)
+		}
+		rawVersion, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(rawVersion)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %q: invalid version number", filename)
+		}
+
+		body, err := fs.ReadFile(migrationFiles, "migrations/"+filename)
+		if err != nil {
+			return nil, fmt.Errorf("reading migration %q: %w", filename, err)
+		}
+
+		m, found := byVersion[version]
+		if !found {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		} else if m.name != name {
+			return nil, fmt.Errorf("migration %q: version %d is already used by %q", filename, version, m.name)
+		}
+		if direction == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	var migrations = make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s: both up and down files are required", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	for i, m := range migrations {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// checkFTS5 returns ErrFTS5Unavailable if the full-text search tables (see the photo_search migration) can't be
+// created or used. It's checked before changing the schema, so that a build without FTS5 can't leave the database
+// half-migrated.
+func checkFTS5(db *sql.DB) error {
+	// Both statements run on the same connection, where the temporary table lives
+	_, err := db.Exec(`CREATE VIRTUAL TABLE temp.fts5_probe USING fts5(body); DROP TABLE temp.fts5_probe;`)
+	if err != nil && strings.Contains(err.Error(), "no such module") {
+		return ErrFTS5Unavailable
+	} else if err != nil {
+		return fmt.Errorf("checking the FTS5 extension: %w", err)
+	}
+	return nil
+}
+
+// checkEmpty returns ErrUnversionedSchema if the database has tables other than schema_version, listing them
+func checkEmpty(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT name FROM sqlite_master
+			WHERE type = 'table' AND name != 'schema_version' AND name NOT LIKE 'sqlite_%'
+			ORDER BY name`)
+	if err != nil {
+		return fmt.Errorf("listing tables: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("listing tables: %w", err)
+		}
+		tables = append(tables, name)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("listing tables: %w", err)
+	} else if len(tables) > 0 {
+		return fmt.Errorf("%w (tables: %s)", ErrUnversionedSchema, strings.Join(tables, ", "))
+	}
+	return nil
+}
+
+// ensureVersionTable creates the table tracking applied migrations, if it doesn't exist.
+func ensureVersionTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+						version INTEGER NOT NULL PRIMARY KEY,
+						name TEXT NOT NULL,
+						applied_at INTEGER NOT NULL
+					);`)
+	return err
+}
+
+// currentVersion returns the version of the last migration applied to the database, or 0 if the database is empty.
+func currentVersion(q interface {
+	QueryRow(query string, args ...any) *sql.Row
+}) (int, error) {
+	var version int
+	err := q.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
+
+// SchemaVersion returns the version of the database schema, and the latest version known by this program.
+func SchemaVersion(db *sql.DB) (int, int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := ensureVersionTable(db); err != nil {
+		return 0, 0, fmt.Errorf("creating schema_version table: %w", err)
+	}
+	current, err := currentVersion(db)
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	return current, len(migrations), nil
+}
+
+// Migrations returns the status of each migration known by this program.
+func Migrations(db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureVersionTable(db); err != nil {
+		return nil, fmt.Errorf("creating schema_version table: %w", err)
+	}
+
+	var applied = map[int]time.Time{}
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_version`)
+	if err != nil {
+		return nil, fmt.Errorf("reading schema version: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("reading schema version: %w", err)
+		}
+		applied[version] = time.Unix(appliedAt, 0).UTC()
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading schema version: %w", err)
+	}
+
+	var status = make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status = append(status, MigrationStatus{
+			Version:   m.version,
+			Name:      m.name,
+			AppliedAt: applied[m.version],
+		})
+	}
+	return status, nil
+}
+
+// MigrateUp applies all pending migrations, each one in its own transaction, and returns how many were applied. If
+// the database schema is newer than the latest known migration, ErrSchemaTooNew is returned and nothing is changed.
+func MigrateUp(db *sql.DB) (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if err := checkFTS5(db); err != nil {
+		return 0, err
+	}
+	if err := ensureVersionTable(db); err != nil {
+		return 0, fmt.Errorf("creating schema_version table: %w", err)
+	}
+
+	var applied int
+	for {
+		done, err := migrateStep(db, migrations, true)
+		if err != nil || done {
+			return applied, err
+		}
+		applied++
+	}
+}
+
+// MigrateDown reverts the last applied migration in a transaction. It returns false if there was nothing to revert.
+func MigrateDown(db *sql.DB) (bool, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return false, err
+	}
+	if err := checkFTS5(db); err != nil {
+		return false, err
+	}
+	if err := ensureVersionTable(db); err != nil {
+		return false, fmt.Errorf("creating schema_version table: %w", err)
+	}
+
+	done, err := migrateStep(db, migrations, false)
+	return !done && err == nil, err
+}
+
+// migrateStep applies the next migration (or reverts the current one if `up` is false) in a transaction. The version
+// is read in the same transaction, so concurrent instances can't apply the same migration twice. It returns true if
+// there was nothing to do.
+func migrateStep(db *sql.DB, migrations []migration, up bool) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	current, err := currentVersion(tx)
+	if err != nil {
+		return false, fmt.Errorf("reading schema version: %w", err)
+	}
+	if current > len(migrations) {
+		return false, fmt.Errorf("%w (database: %d, latest: %d)", ErrSchemaTooNew, current, len(migrations))
+	}
+
+	if up {
+		if current == len(migrations) {
+			return true, nil
+		} else if current == 0 {
+			if err := checkEmpty(tx); err != nil {
+				return false, err
+			}
+		}
+		m := migrations[current]
+		if _, err := tx.Exec(m.up); err != nil {
+			return false, fmt.Errorf("applying migration %d_%s: %w", m.version, m.name, err)
+		}
+		_, err = tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`,
+			m.version, m.name, globaltime.Now().Unix())
+		if err != nil {
+			return false, fmt.Errorf("recording migration %d_%s: %w", m.version, m.name, err)
+		}
+	} else {
+		if current == 0 {
+			return true, nil
+		}
+		m := migrations[current-1]
+		if _, err := tx.Exec(m.down); err != nil {
+			return false, fmt.Errorf("reverting migration %d_%s: %w", m.version, m.name, err)
+		}
+		if _, err = tx.Exec(`DELETE FROM schema_version WHERE version = ?`, m.version); err != nil {
+			return false, fmt.Errorf("recording migration %d_%s: %w", m.version, m.name, err)
+		}
+	}
+
+	return false, tx.Commit()
+}
@@ -0,0 +1,7 @@
+DROP TABLE sessions;
+DROP TABLE comments;
+DROP TABLE likes;
+DROP TABLE bans;
+DROP TABLE follows;
+DROP TABLE photos;
+DROP TABLE users;
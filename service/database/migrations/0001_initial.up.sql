@@ -0,0 +1,55 @@
+-- Initial schema. Databases created before the migration engine was introduced are refused by the engine instead of
+-- being adopted: their tables may have other columns.
+CREATE TABLE users (
+	user_id VARCHAR(20) NOT NULL PRIMARY KEY,
+	user_name VARCHAR(55) NOT NULL UNIQUE,
+	photo_nr INTEGER NOT NULL DEFAULT 0,
+	followers_nr INTEGER NOT NULL DEFAULT 0,
+	following_nr INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE photos (
+	user_id VARCHAR(20) NOT NULL,
+	user_name VARCHAR(55) NOT NULL,
+	photo_id VARCHAR(20) NOT NULL PRIMARY KEY,
+	photo_data VARCHAR(255),
+	photo_time DATETIME,
+	like_nr INTEGER NOT NULL DEFAULT 0,
+	comment_nr INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+CREATE TABLE follows (
+	user_id VARCHAR(20) NOT NULL,
+	followed_id VARCHAR(20) NOT NULL,
+	PRIMARY KEY (user_id, followed_id)
+);
+
+CREATE TABLE bans (
+	user_id VARCHAR(20) NOT NULL,
+	banned_id VARCHAR(20) NOT NULL,
+	PRIMARY KEY (user_id, banned_id)
+);
+
+CREATE TABLE likes (
+	user_id VARCHAR(20) NOT NULL,
+	liked_id VARCHAR(20) NOT NULL,
+	photo_id VARCHAR(20) NOT NULL,
+	like_id VARCHAR(20) NOT NULL,
+	PRIMARY KEY (user_id, photo_id)
+);
+
+CREATE TABLE comments (
+	user_id VARCHAR(20) NOT NULL,
+	commented_id VARCHAR(20) NOT NULL,
+	photo_id VARCHAR(20) NOT NULL,
+	comment_body TEXT NOT NULL
+);
+
+CREATE TABLE sessions (
+	token VARCHAR(64) NOT NULL PRIMARY KEY,
+	user_id VARCHAR(20) NOT NULL,
+	created_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
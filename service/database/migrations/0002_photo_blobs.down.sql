@@ -0,0 +1,12 @@
+DROP TABLE photos;
+
+CREATE TABLE photos (
+	user_id VARCHAR(20) NOT NULL,
+	user_name VARCHAR(55) NOT NULL,
+	photo_id VARCHAR(20) NOT NULL PRIMARY KEY,
+	photo_data VARCHAR(255),
+	photo_time DATETIME,
+	like_nr INTEGER NOT NULL DEFAULT 0,
+	comment_nr INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
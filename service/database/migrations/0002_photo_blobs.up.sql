@@ -0,0 +1,16 @@
+-- Photo contents are saved in the blob store: the table keeps the blob key and the metadata only. The previous table
+-- could not store any image, so its rows are dropped.
+DROP TABLE photos;
+
+CREATE TABLE photos (
+	photo_id VARCHAR(20) NOT NULL PRIMARY KEY,
+	user_id VARCHAR(20) NOT NULL,
+	blob_key VARCHAR(64) NOT NULL UNIQUE,
+	content_type VARCHAR(64) NOT NULL,
+	size INTEGER NOT NULL,
+	hash VARCHAR(64) NOT NULL,
+	photo_time INTEGER NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+CREATE INDEX photos_user_time ON photos (user_id, photo_time);
@@ -0,0 +1,13 @@
+-- Resized copies of photos, generated in background after the upload
+CREATE TABLE photo_variants (
+	photo_id VARCHAR(20) NOT NULL,
+	size INTEGER NOT NULL,
+	blob_key VARCHAR(64) NOT NULL UNIQUE,
+	content_type VARCHAR(64) NOT NULL,
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	bytes INTEGER NOT NULL,
+	hash VARCHAR(64) NOT NULL,
+	PRIMARY KEY (photo_id, size),
+	FOREIGN KEY (photo_id) REFERENCES photos(photo_id)
+);
@@ -0,0 +1,4 @@
+DROP TRIGGER follows_count_delete;
+DROP TRIGGER follows_count_insert;
+DROP TRIGGER photos_count_delete;
+DROP TRIGGER photos_count_insert;
@@ -0,0 +1,23 @@
+-- The counters in the users table are maintained by triggers, in the same transaction of the change
+UPDATE users SET
+	photo_nr = (SELECT COUNT(*) FROM photos WHERE photos.user_id = users.user_id),
+	followers_nr = (SELECT COUNT(*) FROM follows WHERE follows.followed_id = users.user_id),
+	following_nr = (SELECT COUNT(*) FROM follows WHERE follows.user_id = users.user_id);
+
+CREATE TRIGGER photos_count_insert AFTER INSERT ON photos BEGIN
+	UPDATE users SET photo_nr = photo_nr + 1 WHERE user_id = NEW.user_id;
+END;
+
+CREATE TRIGGER photos_count_delete AFTER DELETE ON photos BEGIN
+	UPDATE users SET photo_nr = photo_nr - 1 WHERE user_id = OLD.user_id;
+END;
+
+CREATE TRIGGER follows_count_insert AFTER INSERT ON follows BEGIN
+	UPDATE users SET following_nr = following_nr + 1 WHERE user_id = NEW.user_id;
+	UPDATE users SET followers_nr = followers_nr + 1 WHERE user_id = NEW.followed_id;
+END;
+
+CREATE TRIGGER follows_count_delete AFTER DELETE ON follows BEGIN
+	UPDATE users SET following_nr = following_nr - 1 WHERE user_id = OLD.user_id;
+	UPDATE users SET followers_nr = followers_nr - 1 WHERE user_id = OLD.followed_id;
+END;
@@ -0,0 +1 @@
+DROP INDEX users_user_name_nocase;
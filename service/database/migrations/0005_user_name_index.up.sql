@@ -0,0 +1,2 @@
+-- Case-insensitive index for the user search
+CREATE INDEX users_user_name_nocase ON users (user_name COLLATE NOCASE);
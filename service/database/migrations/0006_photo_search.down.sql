@@ -0,0 +1,11 @@
+DROP TRIGGER comments_fts_update;
+DROP TRIGGER comments_fts_delete;
+DROP TRIGGER comments_fts_insert;
+DROP TRIGGER photos_fts_update;
+DROP TRIGGER photos_fts_delete;
+DROP TRIGGER photos_fts_insert;
+
+DROP TABLE comments_fts;
+DROP TABLE photo_captions_fts;
+
+ALTER TABLE photos DROP COLUMN caption;
@@ -0,0 +1,43 @@
+-- Photos get an optional caption, searchable like the comment bodies
+ALTER TABLE photos ADD COLUMN caption TEXT NOT NULL DEFAULT '';
+
+-- Full-text indexes over captions and comment bodies. They are external content tables: the text is read from photos
+-- and comments by row ID, and the triggers below keep the indexes in sync. The row IDs of these tables are not
+-- aliased by a column, so `INSERT INTO ..._fts (..._fts) VALUES ('rebuild')` must be run after a VACUUM.
+CREATE VIRTUAL TABLE photo_captions_fts USING fts5(caption, content='photos', content_rowid='rowid');
+CREATE VIRTUAL TABLE comments_fts USING fts5(comment_body, content='comments', content_rowid='rowid');
+
+INSERT INTO photo_captions_fts (photo_captions_fts) VALUES ('rebuild');
+INSERT INTO comments_fts (comments_fts) VALUES ('rebuild');
+
+CREATE TRIGGER photos_fts_insert AFTER INSERT ON photos
+BEGIN
+	INSERT INTO photo_captions_fts (rowid, caption) VALUES (new.rowid, new.caption);
+END;
+
+CREATE TRIGGER photos_fts_delete AFTER DELETE ON photos
+BEGIN
+	INSERT INTO photo_captions_fts (photo_captions_fts, rowid, caption) VALUES ('delete', old.rowid, old.caption);
+END;
+
+CREATE TRIGGER photos_fts_update AFTER UPDATE OF caption ON photos
+BEGIN
+	INSERT INTO photo_captions_fts (photo_captions_fts, rowid, caption) VALUES ('delete', old.rowid, old.caption);
+	INSERT INTO photo_captions_fts (rowid, caption) VALUES (new.rowid, new.caption);
+END;
+
+CREATE TRIGGER comments_fts_insert AFTER INSERT ON comments
+BEGIN
+	INSERT INTO comments_fts (rowid, comment_body) VALUES (new.rowid, new.comment_body);
+END;
+
+CREATE TRIGGER comments_fts_delete AFTER DELETE ON comments
+BEGIN
+	INSERT INTO comments_fts (comments_fts, rowid, comment_body) VALUES ('delete', old.rowid, old.comment_body);
+END;
+
+CREATE TRIGGER comments_fts_update AFTER UPDATE OF comment_body ON comments
+BEGIN
+	INSERT INTO comments_fts (comments_fts, rowid, comment_body) VALUES ('delete', old.rowid, old.comment_body);
+	INSERT INTO comments_fts (rowid, comment_body) VALUES (new.rowid, new.comment_body);
+END;
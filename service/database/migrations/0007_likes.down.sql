@@ -0,0 +1,13 @@
+CREATE TABLE likes_old (
+	user_id VARCHAR(20) NOT NULL,
+	liked_id VARCHAR(20) NOT NULL,
+	photo_id VARCHAR(20) NOT NULL,
+	like_id VARCHAR(20) NOT NULL,
+	PRIMARY KEY (user_id, photo_id)
+);
+
+INSERT INTO likes_old (user_id, liked_id, photo_id, like_id)
+	SELECT l.user_id, p.user_id, l.photo_id, l.user_id FROM likes l INNER JOIN photos p ON p.photo_id = l.photo_id;
+
+DROP TABLE likes;
+ALTER TABLE likes_old RENAME TO likes;
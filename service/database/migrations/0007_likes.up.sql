@@ -0,0 +1,17 @@
+-- Likes are identified by the photo and the user liking it: each user can like a photo once. The owner of the photo
+-- and the like ID sent by clients were redundant, and they are dropped.
+CREATE TABLE likes_new (
+	photo_id VARCHAR(20) NOT NULL,
+	user_id VARCHAR(20) NOT NULL,
+	PRIMARY KEY (photo_id, user_id),
+	FOREIGN KEY (photo_id) REFERENCES photos(photo_id),
+	FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+INSERT INTO likes_new (photo_id, user_id)
+	SELECT DISTINCT photo_id, user_id FROM likes WHERE photo_id IN (SELECT photo_id FROM photos);
+
+DROP TABLE likes;
+ALTER TABLE likes_new RENAME TO likes;
+
+CREATE INDEX likes_user ON likes (user_id);
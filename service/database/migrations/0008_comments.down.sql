@@ -0,0 +1,31 @@
+CREATE TABLE comments_old (
+	user_id VARCHAR(20) NOT NULL,
+	commented_id VARCHAR(20) NOT NULL,
+	photo_id VARCHAR(20) NOT NULL,
+	comment_body TEXT NOT NULL
+);
+
+INSERT INTO comments_old (user_id, commented_id, photo_id, comment_body)
+	SELECT c.user_id, p.user_id, c.photo_id, c.comment_body FROM comments c INNER JOIN photos p ON p.photo_id = c.photo_id
+	ORDER BY c.rowid;
+
+DROP TABLE comments;
+ALTER TABLE comments_old RENAME TO comments;
+
+INSERT INTO comments_fts (comments_fts) VALUES ('rebuild');
+
+CREATE TRIGGER comments_fts_insert AFTER INSERT ON comments
+BEGIN
+	INSERT INTO comments_fts (rowid, comment_body) VALUES (new.rowid, new.comment_body);
+END;
+
+CREATE TRIGGER comments_fts_delete AFTER DELETE ON comments
+BEGIN
+	INSERT INTO comments_fts (comments_fts, rowid, comment_body) VALUES ('delete', old.rowid, old.comment_body);
+END;
+
+CREATE TRIGGER comments_fts_update AFTER UPDATE OF comment_body ON comments
+BEGIN
+	INSERT INTO comments_fts (comments_fts, rowid, comment_body) VALUES ('delete', old.rowid, old.comment_body);
+	INSERT INTO comments_fts (rowid, comment_body) VALUES (new.rowid, new.comment_body);
+END;
@@ -0,0 +1,40 @@
+-- Comments get an identifier, generated like the photo one, and the time of publishing. The user receiving the
+-- comment is the owner of the photo, so it's not stored anymore.
+CREATE TABLE comments_new (
+	comment_id VARCHAR(20) NOT NULL PRIMARY KEY,
+	photo_id VARCHAR(20) NOT NULL,
+	user_id VARCHAR(20) NOT NULL,
+	comment_body TEXT NOT NULL,
+	comment_time INTEGER NOT NULL,
+	FOREIGN KEY (photo_id) REFERENCES photos(photo_id),
+	FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+-- Row IDs are kept, so that the next generated identifiers don't collide with these ones
+INSERT INTO comments_new (rowid, comment_id, photo_id, user_id, comment_body, comment_time)
+	SELECT rowid, 'Comment' || rowid, photo_id, user_id, comment_body, 0 FROM comments
+	WHERE photo_id IN (SELECT photo_id FROM photos);
+
+-- The full-text index triggers are dropped with the old table, and created again for the new one
+DROP TABLE comments;
+ALTER TABLE comments_new RENAME TO comments;
+
+CREATE INDEX comments_photo_time ON comments (photo_id, comment_time);
+
+INSERT INTO comments_fts (comments_fts) VALUES ('rebuild');
+
+CREATE TRIGGER comments_fts_insert AFTER INSERT ON comments
+BEGIN
+	INSERT INTO comments_fts (rowid, comment_body) VALUES (new.rowid, new.comment_body);
+END;
+
+CREATE TRIGGER comments_fts_delete AFTER DELETE ON comments
+BEGIN
+	INSERT INTO comments_fts (comments_fts, rowid, comment_body) VALUES ('delete', old.rowid, old.comment_body);
+END;
+
+CREATE TRIGGER comments_fts_update AFTER UPDATE OF comment_body ON comments
+BEGIN
+	INSERT INTO comments_fts (comments_fts, rowid, comment_body) VALUES ('delete', old.rowid, old.comment_body);
+	INSERT INTO comments_fts (rowid, comment_body) VALUES (new.rowid, new.comment_body);
+END;
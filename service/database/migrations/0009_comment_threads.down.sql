@@ -0,0 +1,6 @@
+DROP TABLE mentions;
+
+DROP INDEX comments_parent_time;
+
+-- Replies become top-level comments
+ALTER TABLE comments DROP COLUMN parent_id;
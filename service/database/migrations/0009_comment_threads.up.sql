@@ -0,0 +1,15 @@
+-- Comments can reply to a top-level comment of the same photo (one level of threading)
+ALTER TABLE comments ADD COLUMN parent_id VARCHAR(20);
+
+CREATE INDEX comments_parent_time ON comments (parent_id, comment_time);
+
+-- The users mentioned in the comments (as "@username"), resolved when the comment is published
+CREATE TABLE mentions (
+	comment_id VARCHAR(20) NOT NULL,
+	user_id VARCHAR(20) NOT NULL,
+	PRIMARY KEY (comment_id, user_id),
+	FOREIGN KEY (comment_id) REFERENCES comments(comment_id),
+	FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+CREATE INDEX mentions_user ON mentions (user_id);
@@ -0,0 +1 @@
+DROP TABLE username_history;
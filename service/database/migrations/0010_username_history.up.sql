@@ -0,0 +1,13 @@
+-- Every username change. The previous name stays reserved to the user that left it until reserved_until, so that
+-- nobody else can take it while the followers still recognize it.
+CREATE TABLE username_history (
+	user_id VARCHAR(20) NOT NULL,
+	old_name VARCHAR(15) NOT NULL,
+	new_name VARCHAR(15) NOT NULL,
+	changed_at INTEGER NOT NULL,
+	reserved_until INTEGER NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+CREATE INDEX username_history_user ON username_history (user_id, changed_at);
+CREATE INDEX username_history_old_name ON username_history (old_name, reserved_until);
@@ -0,0 +1,9 @@
+-- Last identifier issued for each kind of object whose rows can be deleted, so that identifiers are never issued again
+-- (clients and caches would mistake a new object for the deleted one). Sequences start after the existing rows.
+CREATE TABLE id_sequences (
+	name VARCHAR(20) NOT NULL PRIMARY KEY,
+	last_id INTEGER NOT NULL
+);
+
+INSERT INTO id_sequences (name, last_id)
+	SELECT 'photos', COALESCE(MAX(CAST(SUBSTR(photo_id, 6) AS INTEGER)), 0) FROM photos;
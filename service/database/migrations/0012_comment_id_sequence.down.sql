@@ -0,0 +1 @@
+DELETE FROM id_sequences WHERE name = 'comments';
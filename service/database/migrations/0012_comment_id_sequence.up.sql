@@ -0,0 +1,4 @@
+-- Comment identifiers are never issued again after a deletion either: a retried deletion must not remove another
+-- comment.
+INSERT INTO id_sequences (name, last_id)
+	SELECT 'comments', COALESCE(MAX(CAST(SUBSTR(comment_id, 8) AS INTEGER)), 0) FROM comments;
@@ -0,0 +1 @@
+DROP INDEX bans_banned_id;
@@ -0,0 +1,2 @@
+-- The visibility policy looks up the users that banned the viewer in every read path (see visibleOwner)
+CREATE INDEX bans_banned_id ON bans (banned_id);
@@ -0,0 +1 @@
+DROP INDEX follows_followed_id;
@@ -0,0 +1,2 @@
+-- The followers of a user are listed by followed_id, which is not a prefix of the primary key
+CREATE INDEX follows_followed_id ON follows (followed_id);
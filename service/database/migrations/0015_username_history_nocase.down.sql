@@ -0,0 +1,2 @@
+DROP INDEX username_history_old_name;
+CREATE INDEX username_history_old_name ON username_history (old_name, reserved_until);
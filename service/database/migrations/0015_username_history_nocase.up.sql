@@ -0,0 +1,3 @@
+-- Reservations are case-insensitive, like the usernames: nobody else can take "Bob" right after "bob" is left
+DROP INDEX username_history_old_name;
+CREATE INDEX username_history_old_name ON username_history (old_name COLLATE NOCASE, reserved_until);
@@ -0,0 +1,2 @@
+DROP INDEX users_user_name_nocase;
+CREATE INDEX users_user_name_nocase ON users (user_name COLLATE NOCASE);
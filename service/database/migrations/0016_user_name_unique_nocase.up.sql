@@ -0,0 +1,5 @@
+-- Usernames differing only in case are the same name: "alice" and "Alice" can't be two users. The index replaces the
+-- case-insensitive one used by the user search. It fails if the database already has such duplicates, which must be
+-- renamed first.
+DROP INDEX users_user_name_nocase;
+CREATE UNIQUE INDEX users_user_name_nocase ON users (user_name COLLATE NOCASE);
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"time"
+)
+
+// Observer receives the duration of each AppDatabase operation, identified by the method name (e.g., "GetUser")
+type Observer func(op string, d time.Duration)
+
+// Observe returns an AppDatabase that calls `db` and reports the duration of each operation to `observe` (e.g., to
+// collect latency metrics). Failed operations are reported too.
+func Observe(db AppDatabase, observe Observer) AppDatabase {
+	return observedDatabase{db: db, observe: observe}
+}
+
+type observedDatabase struct {
+	db      AppDatabase
+	observe Observer
+}
+
+// since reports the time elapsed since start for op. Use it with defer, evaluating time.Now() when deferring.
+func (o observedDatabase) since(op string, start time.Time) {
+	o.observe(op, time.Since(start))
+}
+
+func (o observedDatabase) CreateSession(s Session) error {
+	defer o.since("CreateSession", time.Now())
+	return o.db.CreateSession(s)
+}
+
+func (o observedDatabase) GetSession(token string) (Session, error) {
+	defer o.since("GetSession", time.Now())
+	return o.db.GetSession(token)
+}
+
+func (o observedDatabase) RevokeSession(token string) error {
+	defer o.since("RevokeSession", time.Now())
+	return o.db.RevokeSession(token)
+}
+
+func (o observedDatabase) DeleteExpiredSessions(now time.Time) (int64, error) {
+	defer o.since("DeleteExpiredSessions", time.Now())
+	return o.db.DeleteExpiredSessions(now)
+}
+
+func (o observedDatabase) GetUser(userID string) (User, error) {
+	defer o.since("GetUser", time.Now())
+	return o.db.GetUser(userID)
+}
+
+func (o observedDatabase) LoginOrRegister(username string, now time.Time) (User, bool, error) {
+	defer o.since("LoginOrRegister", time.Now())
+	return o.db.LoginOrRegister(username, now)
+}
+
+func (o observedDatabase) SetUsername(c UsernameChange) (User, error) {
+	defer o.since("SetUsername", time.Now())
+	return o.db.SetUsername(c)
+}
+
+func (o observedDatabase) GetUserStream(userID string, cursor string, limit int) ([]Photo, string, error) {
+	defer o.since("GetUserStream", time.Now())
+	return o.db.GetUserStream(userID, cursor, limit)
+}
+
+func (o observedDatabase) GetUserPhotos(viewerID string, userID string, cursor string, limit int) ([]Photo, string, error) {
+	defer o.since("GetUserPhotos", time.Now())
+	return o.db.GetUserPhotos(viewerID, userID, cursor, limit)
+}
+
+func (o observedDatabase) SearchUsers(searcherID string, query string, cursor string, limit int) ([]User, string, error) {
+	defer o.since("SearchUsers", time.Now())
+	return o.db.SearchUsers(searcherID, query, cursor, limit)
+}
+
+func (o observedDatabase) SearchPhotos(viewerID string, query string, followedOnly bool, cursor string, limit int) ([]PhotoSearchResult, string, error) {
+	defer o.since("SearchPhotos", time.Now())
+	return o.db.SearchPhotos(viewerID, query, followedOnly, cursor, limit)
+}
+
+func (o observedDatabase) GetPhoto(photoID string) (Photo, error) {
+	defer o.since("GetPhoto", time.Now())
+	return o.db.GetPhoto(photoID)
+}
+
+func (o observedDatabase) UploadPhoto(p Photo) (Photo, error) {
+	defer o.since("UploadPhoto", time.Now())
+	return o.db.UploadPhoto(p)
+}
+
+func (o observedDatabase) AddPhotoVariant(v PhotoVariant, photoBlobKey string) error {
+	defer o.since("AddPhotoVariant", time.Now())
+	return o.db.AddPhotoVariant(v, photoBlobKey)
+}
+
+func (o observedDatabase) GetPhotoVariant(photoID string, size int) (PhotoVariant, error) {
+	defer o.since("GetPhotoVariant", time.Now())
+	return o.db.GetPhotoVariant(photoID, size)
+}
+
+func (o observedDatabase) DeletePhoto(photoID string) ([]string, error) {
+	defer o.since("DeletePhoto", time.Now())
+	return o.db.DeletePhoto(photoID)
+}
+
+func (o observedDatabase) AddLike(l LikeAction) (bool, error) {
+	defer o.since("AddLike", time.Now())
+	return o.db.AddLike(l)
+}
+
+func (o observedDatabase) RemoveLike(l LikeAction) error {
+	defer o.since("RemoveLike", time.Now())
+	return o.db.RemoveLike(l)
+}
+
+func (o observedDatabase) GetLikers(viewerID string, photoID string, cursor string, limit int) ([]User, string, error) {
+	defer o.since("GetLikers", time.Now())
+	return o.db.GetLikers(viewerID, photoID, cursor, limit)
+}
+
+func (o observedDatabase) AddComment(c Comment) (Comment, error) {
+	defer o.since("AddComment", time.Now())
+	return o.db.AddComment(c)
+}
+
+func (o observedDatabase) GetComment(commentID string) (Comment, error) {
+	defer o.since("GetComment", time.Now())
+	return o.db.GetComment(commentID)
+}
+
+func (o observedDatabase) RemoveComment(commentID string) error {
+	defer o.since("RemoveComment", time.Now())
+	return o.db.RemoveComment(commentID)
+}
+
+func (o observedDatabase) GetComments(viewerID string, photoID string, cursor string, limit int) ([]Comment, string, error) {
+	defer o.since("GetComments", time.Now())
+	return o.db.GetComments(viewerID, photoID, cursor, limit)
+}
+
+func (o observedDatabase) FollowUser(f FollowAction) (bool, error) {
+	defer o.since("FollowUser", time.Now())
+	return o.db.FollowUser(f)
+}
+
+func (o observedDatabase) UnfollowUser(f FollowAction) error {
+	defer o.since("UnfollowUser", time.Now())
+	return o.db.UnfollowUser(f)
+}
+
+func (o observedDatabase) GetFollowers(viewerID string, userID string, cursor string, limit int) ([]User, string, error) {
+	defer o.since("GetFollowers", time.Now())
+	return o.db.GetFollowers(viewerID, userID, cursor, limit)
+}
+
+func (o observedDatabase) GetFollowing(viewerID string, userID string, cursor string, limit int) ([]User, string, error) {
+	defer o.since("GetFollowing", time.Now())
+	return o.db.GetFollowing(viewerID, userID, cursor, limit)
+}
+
+func (o observedDatabase) BanUser(b BanAction) (bool, error) {
+	defer o.since("BanUser", time.Now())
+	return o.db.BanUser(b)
+}
+
+func (o observedDatabase) UnbanUser(b BanAction) error {
+	defer o.since("UnbanUser", time.Now())
+	return o.db.UnbanUser(b)
+}
+
+func (o observedDatabase) CanSee(viewerID string, ownerID string) (bool, error) {
+	defer o.since("CanSee", time.Now())
+	return o.db.CanSee(viewerID, ownerID)
+}
+
+func (o observedDatabase) GetTotals() (Totals, error) {
+	defer o.since("GetTotals", time.Now())
+	return o.db.GetTotals()
+}
+
+func (o observedDatabase) CheckSchema() error {
+	defer o.since("CheckSchema", time.Now())
+	return o.db.CheckSchema()
+}
+
+func (o observedDatabase) Ping() error {
+	defer o.since("Ping", time.Now())
+	return o.db.Ping()
+}
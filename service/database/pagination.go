@@ -0,0 +1,33 @@
+package database
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor can't be decoded
+var ErrInvalidCursor = NewError(ErrValidation, "invalid pagination cursor")
+
+// Lists are paginated using keysets: a cursor is the opaque encoding of the sort key of the last item of a page, and
+// the next page starts right after it. Unlike offsets, cursors are stable when items are added or removed.
+
+// encodeCursor encodes the sort key fields of the last item of a page.
+func encodeCursor(fields ...string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(fields, "\x00")))
+}
+
+// decodeCursor decodes a cursor made of n fields. An empty cursor means the first page, and it's returned as nil.
+func decodeCursor(cursor string, n int) ([]string, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	fields := strings.Split(string(raw), "\x00")
+	if len(fields) != n {
+		return nil, ErrInvalidCursor
+	}
+	return fields, nil
+}
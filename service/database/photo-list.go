@@ -0,0 +1,74 @@
+package database
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// photoListColumns selects the photo fields, with counters and whether the viewer (the first query argument) liked
+// the photo. It requires photos to be aliased `p` and joined with users aliased `u`.
+const photoListColumns = `p.photo_id, p.user_id, u.user_name, p.blob_key, p.content_type, p.size, p.hash, p.caption,
+		p.photo_time, p.rowid,
+		(SELECT COUNT(*) FROM likes l WHERE l.photo_id = p.photo_id),
+		(SELECT COUNT(*) FROM comments c WHERE c.photo_id = p.photo_id),
+		EXISTS (SELECT 1 FROM likes l WHERE l.photo_id = p.photo_id AND l.user_id = ?)`
+
+// photoListCursor returns the condition selecting photos after the cursor, in reverse chronological order, and its
+// arguments. Photos published in the same second are sorted by row ID.
+func photoListCursor(cursor string) (string, []any, error) {
+	fields, err := decodeCursor(cursor, 2)
+	if err != nil {
+		return "", nil, err
+	} else if fields == nil {
+		return "true", nil, nil
+	}
+
+	photoTime, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return "", nil, ErrInvalidCursor
+	}
+	rowid, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return "", nil, ErrInvalidCursor
+	}
+	return "(p.photo_time, p.rowid) < (?, ?)", []any{photoTime, rowid}, nil
+}
+
+// scanPhotoList reads up to limit photos selected with photoListColumns. If there are more rows (queries should ask
+// for limit+1 rows), the cursor of the next page is returned too.
+func scanPhotoList(rows *sql.Rows, limit int) ([]Photo, string, error) {
+	defer func() { _ = rows.Close() }()
+
+	var photos = []Photo{}
+	var next string
+	var lastRowID int64
+	for rows.Next() {
+		var p Photo
+		rowid, err := scanPhotoRow(rows, &p)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(photos) == limit {
+			last := photos[len(photos)-1]
+			next = encodeCursor(strconv.FormatInt(last.PhotoTime.Unix(), 10), strconv.FormatInt(lastRowID, 10))
+			break
+		}
+		photos = append(photos, p)
+		lastRowID = rowid
+	}
+	return photos, next, rows.Err()
+}
+
+// scanPhotoRow reads the current row, selected with photoListColumns followed by the extra columns, into p. It
+// returns the row ID of the photo.
+func scanPhotoRow(rows *sql.Rows, p *Photo, extra ...any) (int64, error) {
+	var photoTime, rowid int64
+	dest := append([]any{&p.PhotoID, &p.UserID, &p.UserName, &p.BlobKey, &p.ContentType, &p.Size, &p.Hash, &p.Caption,
+		&photoTime, &rowid, &p.LikeNr, &p.CommentNr, &p.Liked}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	p.PhotoTime = time.Unix(photoTime, 0).UTC()
+	return rowid, nil
+}
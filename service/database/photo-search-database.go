@@ -0,0 +1,143 @@
+package database
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Snippets are cut to about snippetTokens words. FTS5 encloses the matching terms between snippetOpen and
+// snippetClose, that are replaced by <mark> and </mark> once the text has been escaped (see highlightSnippet).
+const (
+	snippetOpen   = "\x02"
+	snippetClose  = "\x03"
+	snippetTokens = 12
+)
+
+// snippetMarkers turns the FTS5 markers into HTML tags
+var snippetMarkers = strings.NewReplacer(snippetOpen, "<mark>", snippetClose, "</mark>")
+
+// highlightSnippet returns the snippet as HTML: the text written by users is escaped, so it can't inject markup, and
+// the matching terms are enclosed in <mark> and </mark>.
+func highlightSnippet(snippet string) string {
+	return snippetMarkers.Replace(html.EscapeString(snippet))
+}
+
+// ftsQuery turns the words of a user query into an FTS5 query matching all of them. Each word is quoted, so the FTS5
+// syntax (operators, column filters, etc.) is not available to users and can't cause syntax errors.
+func ftsQuery(query string) string {
+	words := strings.Fields(query)
+	for i := range words {
+		words[i] = `"` + strings.ReplaceAll(words[i], `"`, `""`) + `"`
+	}
+	return strings.Join(words, " ")
+}
+
+// SearchPhotos returns a page of photos whose caption or comments contain all the words in query, the most relevant
+// first. Each photo comes with a snippet of its best matching text. Photos of the users followed by viewerID come
+// first; if followedOnly is true, the other photos are excluded. Photos and comments of users that banned viewerID
+// are excluded.
+func (db *appdbimpl) SearchPhotos(viewerID string, query string, followedOnly bool, cursor string, limit int) ([]PhotoSearchResult, string, error) {
+	fields, err := decodeCursor(cursor, 4)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Results are sorted by group (0 for the photos of followed users, 1 for the others), by source of the match (0
+	// for captions, 1 for comments), by BM25 score (lower is better), then by row ID in reverse, like other photo
+	// lists. BM25 scores depend on the statistics of each table, so they are compared between the same source only.
+	var after = "true"
+	var afterArgs []any
+	if fields != nil {
+		group, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		source, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		score, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		rowid, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		after = "((m.grp, m.source, m.score) > (?, ?, ?) OR ((m.grp, m.source, m.score) = (?, ?, ?) AND p.rowid < ?))"
+		afterArgs = []any{group, source, score, group, source, score, rowid}
+	}
+
+	match := ftsQuery(query)
+	if match == "" {
+		return []PhotoSearchResult{}, "", nil
+	}
+
+	var followed = "true"
+	if followedOnly {
+		followed = "m.grp = 0"
+	}
+
+	// A photo may match both in the caption and in several comments: only the best match is kept, preferring the
+	// caption
+	snippet := `'` + snippetOpen + `', '` + snippetClose + `', '…', ` + strconv.Itoa(snippetTokens)
+	args := append([]any{viewerID, viewerID, match, match, viewerID, viewerID}, afterArgs...)
+	rows, err := db.c.Query(`SELECT `+photoListColumns+`, m.grp, m.source, m.score, m.snippet
+			FROM (
+				SELECT b.photo_rowid, b.source, b.score, b.snippet,
+					CASE WHEN bp.user_id IN (SELECT followed_id FROM follows WHERE user_id = ?) THEN 0 ELSE 1 END AS grp
+				FROM (
+					SELECT *, ROW_NUMBER() OVER (PARTITION BY photo_rowid ORDER BY source, score) AS n FROM (
+						SELECT rowid AS photo_rowid, 0 AS source, bm25(photo_captions_fts) AS score,
+							snippet(photo_captions_fts, 0, `+snippet+`) AS snippet
+						FROM photo_captions_fts
+						WHERE photo_captions_fts MATCH ?
+						UNION ALL
+						SELECT p.rowid, 1, bm25(comments_fts), snippet(comments_fts, 0, `+snippet+`)
+						FROM comments_fts
+							INNER JOIN comments c ON c.rowid = comments_fts.rowid
+							INNER JOIN photos p ON p.photo_id = c.photo_id
+						WHERE comments_fts MATCH ?
+							AND `+visibleOwner("c.user_id")+`
+					)
+				) b
+					INNER JOIN photos bp ON bp.rowid = b.photo_rowid
+				WHERE b.n = 1
+			) m
+				INNER JOIN photos p ON p.rowid = m.photo_rowid
+				INNER JOIN users u ON u.user_id = p.user_id
+			WHERE `+visibleOwner("p.user_id")+`
+				AND `+followed+`
+				AND `+after+`
+			ORDER BY m.grp, m.source, m.score, p.rowid DESC
+			LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var results = []PhotoSearchResult{}
+	var next string
+	var lastGroup, lastSource int
+	var lastScore float64
+	var lastRowID int64
+	for rows.Next() {
+		var r PhotoSearchResult
+		var group, source int
+		var score float64
+		rowid, err := scanPhotoRow(rows, &r.Photo, &group, &source, &score, &r.Snippet)
+		if err != nil {
+			return nil, "", err
+		}
+		r.Snippet = highlightSnippet(r.Snippet)
+		if len(results) == limit {
+			next = encodeCursor(strconv.Itoa(lastGroup), strconv.Itoa(lastSource),
+				strconv.FormatFloat(lastScore, 'g', -1, 64), strconv.FormatInt(lastRowID, 10))
+			break
+		}
+		results = append(results, r)
+		lastGroup, lastSource, lastScore, lastRowID = group, source, score, rowid
+	}
+	return results, next, rows.Err()
+}
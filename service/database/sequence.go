@@ -0,0 +1,17 @@
+package database
+
+import (
+	"database/sql"
+	"strconv"
+)
+
+// nextID returns a new identifier for the objects of the sequence name (see the id_sequences table), like "Photo12"
+// with prefix "Photo". Identifiers are never issued twice, even after the objects are deleted.
+func nextID(tx *sql.Tx, name string, prefix string) (string, error) {
+	var id int64
+	err := tx.QueryRow(`UPDATE id_sequences SET last_id = last_id + 1 WHERE name = ? RETURNING last_id`, name).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+	return prefix + strconv.FormatInt(id, 10), nil
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/globaltime"
+	"time"
+)
+
+// CreateSession stores a new session. Timestamps are saved as UNIX seconds, so expired sessions can be found using a
+// simple comparison.
+func (db *appdbimpl) CreateSession(s Session) error {
+	_, err := db.c.Exec(`INSERT INTO sessions (token, user_id, created_at, expires_at) VALUES (?, ?, ?, ?)`,
+		s.Token, s.UserID, s.CreatedAt.Unix(), s.ExpiresAt.Unix())
+	return err
+}
+
+// GetSession returns the session identified by token. Unknown and expired sessions are reported as ErrSessionNotFound.
+func (db *appdbimpl) GetSession(token string) (Session, error) {
+	var s Session
+	var createdAt, expiresAt int64
+
+	err := db.c.QueryRow(`SELECT token, user_id, created_at, expires_at FROM sessions WHERE token = ?`, token).Scan(
+		&s.Token, &s.UserID, &createdAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, ErrSessionNotFound
+	} else if err != nil {
+		return s, err
+	}
+
+	s.CreatedAt = time.Unix(createdAt, 0).UTC()
+	s.ExpiresAt = time.Unix(expiresAt, 0).UTC()
+	if !globaltime.Now().Before(s.ExpiresAt) {
+		return Session{}, ErrSessionNotFound
+	}
+	return s, nil
+}
+
+// RevokeSession deletes the session identified by token, so it can't be used anymore.
+func (db *appdbimpl) RevokeSession(token string) error {
+	res, err := db.c.Exec(`DELETE FROM sessions WHERE token = ?`, token)
+	if err != nil {
+		return err
+	}
+
+	rows_aff, err := res.RowsAffected()
+	if err != nil {
+		return err
+	} else if rows_aff == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// DeleteExpiredSessions removes all sessions expired at the time `now`, and returns how many were removed.
+func (db *appdbimpl) DeleteExpiredSessions(now time.Time) (int64, error) {
+	res, err := db.c.Exec(`DELETE FROM sessions WHERE expires_at <= ?`, now.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
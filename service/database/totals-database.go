@@ -0,0 +1,21 @@
+package database
+
+// Totals are the sizes of the whole application, e.g. for monitoring
+type Totals struct {
+	Users  int64
+	Photos int64
+
+	// BlobBytes is the size of the photo contents in the blob store, resized copies included
+	BlobBytes int64
+}
+
+// GetTotals returns the number of users and photos, and the bytes of photo contents stored in the blob store
+func (db *appdbimpl) GetTotals() (Totals, error) {
+	var t Totals
+	err := db.c.QueryRow(`SELECT
+			(SELECT COUNT(*) FROM users),
+			(SELECT COUNT(*) FROM photos),
+			(SELECT COALESCE(SUM(size), 0) FROM photos) + (SELECT COALESCE(SUM(bytes), 0) FROM photo_variants)`).Scan(
+		&t.Users, &t.Photos, &t.BlobBytes)
+	return t, err
+}
@@ -3,94 +3,207 @@ package database
 import (
 	"database/sql"
 	"errors"
-	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
-func (db *appdbimpl) SetUserID(u User, s string) (User, error) {
-	if len(s) == 0 {
-		res, err := db.c.Exec("INSERT INTO users(user_id) VALUES (?)")
-
-		if err != nil {
-			var user User
-			if err := db.c.QueryRow(`SELECT user_id FROM users WHERE user_id = ?`, u.UserID).Scan(&user.UserID); err != nil {
-				if err == sql.ErrNoRows {
-					return user, errors.New("404: User not found")
-				}
-			}
-			return user, nil
+// GetUser returns the user identified by userID, or ErrUserNotFound if there is no such user.
+func (db *appdbimpl) GetUser(userID string) (User, error) {
+	var u User
+	err := db.c.QueryRow(`SELECT user_id, user_name, photo_nr, followers_nr, following_nr FROM users WHERE user_id = ?`,
+		userID).Scan(&u.UserID, &u.UserName, &u.PhotoNr, &u.FollowersNr, &u.FollowingNr)
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, ErrUserNotFound
+	}
+	return u, err
+}
+
+// normalizeUsername removes the spaces around username, and checks the result against the username rules: 3 to 15
+// characters (as in the API specification), and no control characters. It returns the trimmed username, and whether
+// it's valid.
+func normalizeUsername(username string) (string, bool) {
+	username = strings.TrimSpace(username)
+	n := utf8.RuneCountInString(username)
+	if n < 3 || n > 15 || !utf8.ValidString(username) {
+		return username, false
+	}
+	for _, r := range username {
+		if unicode.IsControl(r) {
+			return username, false
 		}
-		autoincr, err := res.LastInsertId()
-		u.UserID = fmt.Sprintf("User%d", autoincr)
-	} else {
-		db.c.Exec("INSERT INTO users(user_id) VALUES s")
 	}
-	return u, nil
+	return username, true
 }
 
-func (db *appdbimpl) InitSetUserID(u User) (User, error) {
-	res, err := db.c.Exec("INSERT INTO users(user_id) VALUES (?)")
+// LoginOrRegister returns the user with the given username, ignoring case, registering it if it doesn't exist. The
+// boolean return value is true when the user has been created. Concurrent logins with the same new username register one user only.
+// Usernames recently left by a user (see SetUsername) can't be registered until now is past their reservation: in
+// this case, ErrUsernameReserved is returned.
+func (db *appdbimpl) LoginOrRegister(username string, now time.Time) (User, bool, error) {
+	var u User
+	username, ok := normalizeUsername(username)
+	if !ok {
+		return u, false, ErrInvalidUsername
+	}
 
+	tx, err := db.c.Begin()
 	if err != nil {
-		var user User
-		if err := db.c.QueryRow(`SELECT user_id FROM users WHERE user_id = ?`, u.UserID).Scan(&user.UserID); err != nil {
-			if err == sql.ErrNoRows {
-				return user, errors.New("404: User not found")
-			}
-		}
-		return user, nil
+		return u, false, err
 	}
-	autoincr, err := res.LastInsertId()
-	u.UserID = fmt.Sprintf("User%d", autoincr)
-	return u, nil
-}
+	defer func() { _ = tx.Rollback() }()
 
-func (db *appdbimpl) SetUsername(u User, s string) (User, error) {
-	res, err := db.c.Exec("INSERT INTO users(user_name) VALUES s", u.UserName)
+	reserved, err := usernameReserved(tx, username, "", now)
+	if err != nil {
+		return u, false, err
+	}
 
+	// The new identifier is derived from the row ID in the same statement, so no other login can steal it. If the
+	// username is already taken (in any case), nothing is inserted. The WHERE clause is required by SQLite to parse
+	// the upsert.
+	res, err := tx.Exec(`INSERT INTO users (user_id, user_name)
+			SELECT 'User' || (COALESCE(MAX(rowid), 0) + 1), ? FROM users WHERE true
+			ON CONFLICT (user_name COLLATE NOCASE) DO NOTHING`, username)
+	if err != nil {
+		return u, false, err
+	}
 	rows_aff, err := res.RowsAffected()
-	if rows_aff == 0 || err != nil {
-		return u, err
+	if err != nil {
+		return u, false, err
 	}
 
-	return u, nil
+	err = tx.QueryRow(`SELECT user_id, user_name, photo_nr, followers_nr, following_nr FROM users
+			WHERE user_name = ? COLLATE NOCASE`,
+		username).Scan(&u.UserID, &u.UserName, &u.PhotoNr, &u.FollowersNr, &u.FollowingNr)
+	if err != nil {
+		return u, false, err
+	}
+	if rows_aff == 1 && reserved {
+		// The registration is rolled back: users already having the username can still log in
+		return User{}, false, ErrUsernameReserved
+	}
+
+	return u, rows_aff == 1, tx.Commit()
 }
 
-func (db *appdbimpl) GetUserStream(u User) ([]Photo, error) {
-	var stream []Photo
+// SetUsername changes the username of c.UserID to c.NewName, and records the change. The old username stays reserved
+// to c.UserID until c.ReservedUntil (no reservation if it's not after c.ChangedAt). The user is returned with the new
+// username; nothing is recorded if it's the current one.
+//
+// It returns ErrInvalidUsername if the new username is not valid, ErrUserNotFound if the user doesn't exist,
+// ErrUsernameTaken if another user has the username, and ErrUsernameReserved if another user left it recently.
+func (db *appdbimpl) SetUsername(c UsernameChange) (User, error) {
+	var u User
+	var ok bool
+	c.NewName, ok = normalizeUsername(c.NewName)
+	if !ok {
+		return u, ErrInvalidUsername
+	}
 
-	// Choose photos from following and unbanned users
-	r, err :=
-		db.c.Query(`SELECT * FROM photos WHERE user_id IN (SELECT followed_id FROM follows WHERE user_id = ?
-                                                                         AND followed_id NOT IN (SELECT user_id FROM bans WHERE banned_id = ?))`, u.UserID)
+	tx, err := db.c.Begin()
 	if err != nil {
-		return stream, errors.New("404: Photo not found")
+		return u, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	err = tx.QueryRow(`SELECT user_id, user_name, photo_nr, followers_nr, following_nr FROM users WHERE user_id = ?`,
+		c.UserID).Scan(&u.UserID, &u.UserName, &u.PhotoNr, &u.FollowersNr, &u.FollowingNr)
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, ErrUserNotFound
+	} else if err != nil {
+		return u, err
+	} else if u.UserName == c.NewName {
+		return u, nil
 	}
 
-	if r.Err() != nil {
-		return nil, err
+	// The transaction holds the write lock, so the name can't be taken between these checks and the update. Names
+	// differing only in case are the same name, but users can change the case of their own.
+	var owners int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM users WHERE user_name = ? COLLATE NOCASE AND user_id != ?`,
+		c.NewName, c.UserID).Scan(&owners)
+	if err != nil {
+		return u, err
+	} else if owners > 0 {
+		return u, ErrUsernameTaken
 	}
 
-	return stream, nil
+	reserved, err := usernameReserved(tx, c.NewName, c.UserID, c.ChangedAt)
+	if err != nil {
+		return u, err
+	} else if reserved {
+		return u, ErrUsernameReserved
+	}
+
+	_, err = tx.Exec(`UPDATE users SET user_name = ? WHERE user_id = ?`, c.NewName, c.UserID)
+	if err != nil {
+		return u, err
+	}
+
+	reservedUntil := c.ChangedAt
+	if c.ReservedUntil.After(c.ChangedAt) {
+		reservedUntil = c.ReservedUntil
+	}
+	_, err = tx.Exec(`INSERT INTO username_history (user_id, old_name, new_name, changed_at, reserved_until)
+			VALUES (?, ?, ?, ?, ?)`, c.UserID, u.UserName, c.NewName, c.ChangedAt.Unix(), reservedUntil.Unix())
+	if err != nil {
+		return u, err
+	}
+
+	u.UserName = c.NewName
+	return u, tx.Commit()
 }
 
-func (db *appdbimpl) GetFollowers(u User) (int, error) {
-	var followers_nr int
+// usernameReserved returns whether username has been left by a user other than userID, and it's still reserved at
+// the given time. Names are compared ignoring case (ASCII letters only, as SQLite's NOCASE).
+func usernameReserved(tx *sql.Tx, username string, userID string, now time.Time) (bool, error) {
+	var reservations int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM username_history
+			WHERE old_name = ? COLLATE NOCASE AND reserved_until > ? AND user_id != ?`,
+		username, now.Unix(), userID).Scan(&reservations)
+	return reservations > 0, err
+}
 
-	if err := db.c.QueryRow(`SELECT COUNT(*) FROM follows WHERE followed_id = ?`, u.UserID).Scan(&followers_nr); err != nil {
-		if err == sql.ErrNoRows {
-			return followers_nr, errors.New("404: User not found")
-		}
+// GetUserStream returns a page of photos published by the users followed by userID, in reverse chronological order.
+// Photos of users that banned userID are excluded. The returned cursor selects the next page, and it's empty on the
+// last page.
+func (db *appdbimpl) GetUserStream(userID string, cursor string, limit int) ([]Photo, string, error) {
+	after, afterArgs, err := photoListCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Choose photos from following and unbanned users
+	args := append([]any{userID, userID, userID}, afterArgs...)
+	rows, err := db.c.Query(`SELECT `+photoListColumns+`
+			FROM photos p INNER JOIN users u ON u.user_id = p.user_id
+			WHERE p.user_id IN (SELECT followed_id FROM follows WHERE user_id = ?)
+				AND `+visibleOwner("p.user_id")+`
+				AND `+after+`
+			ORDER BY p.photo_time DESC, p.rowid DESC
+			LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return nil, "", err
 	}
-	return followers_nr, nil
+	return scanPhotoList(rows, limit)
 }
 
-func (db *appdbimpl) GetFollowing(u User) (int, error) {
-	var following_nr int
+// GetUserPhotos returns a page of the photos published by userID, in reverse chronological order, as seen by viewerID
+// (i.e., whether viewerID liked them).
+func (db *appdbimpl) GetUserPhotos(viewerID string, userID string, cursor string, limit int) ([]Photo, string, error) {
+	after, afterArgs, err := photoListCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
 
-	if err := db.c.QueryRow(`SELECT COUNT(*) FROM follows WHERE user_id = ?`, u.UserID).Scan(&following_nr); err != nil {
-		if err == sql.ErrNoRows {
-			return following_nr, errors.New("404: User not found")
-		}
+	args := append([]any{viewerID, userID}, afterArgs...)
+	rows, err := db.c.Query(`SELECT `+photoListColumns+`
+			FROM photos p INNER JOIN users u ON u.user_id = p.user_id
+			WHERE p.user_id = ? AND `+after+`
+			ORDER BY p.photo_time DESC, p.rowid DESC
+			LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return nil, "", err
 	}
-	return following_nr, nil
+	return scanPhotoList(rows, limit)
 }
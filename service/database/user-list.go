@@ -0,0 +1,51 @@
+package database
+
+import (
+	"database/sql"
+	"strconv"
+)
+
+// userListColumns selects the user fields. It requires users to be aliased `u`, and it must be followed by the row ID
+// giving the order of the list (e.g., of the follow, or of the like).
+const userListColumns = `u.user_id, u.user_name, u.photo_nr, u.followers_nr, u.following_nr`
+
+// userListCursor returns the condition selecting the rows after the cursor, in reverse order of the row ID in column,
+// and its arguments
+func userListCursor(cursor string, column string) (string, []any, error) {
+	fields, err := decodeCursor(cursor, 1)
+	if err != nil {
+		return "", nil, err
+	} else if fields == nil {
+		return "true", nil, nil
+	}
+
+	rowid, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return "", nil, ErrInvalidCursor
+	}
+	return column + " < ?", []any{rowid}, nil
+}
+
+// scanUserList reads up to limit users selected with userListColumns and the row ID. If there are more rows (queries
+// should ask for limit+1 rows), the cursor of the next page is returned too.
+func scanUserList(rows *sql.Rows, limit int) ([]User, string, error) {
+	defer func() { _ = rows.Close() }()
+
+	var users = []User{}
+	var next string
+	var lastRowID int64
+	for rows.Next() {
+		var u User
+		var rowid int64
+		if err := rows.Scan(&u.UserID, &u.UserName, &u.PhotoNr, &u.FollowersNr, &u.FollowingNr, &rowid); err != nil {
+			return nil, "", err
+		}
+		if len(users) == limit {
+			next = encodeCursor(strconv.FormatInt(lastRowID, 10))
+			break
+		}
+		users = append(users, u)
+		lastRowID = rowid
+	}
+	return users, next, rows.Err()
+}
@@ -1,76 +1,178 @@
 package database
 
-func (db *appdbimpl) UploadPhoto(p Photo) (Photo, error) {
-	_, err := db.c.Exec(`INSERT INTO photos (userId, user_name, photo_id, photo_data, photo_time, like_nr, comment_nr, liked)
-			VALUES (?, ?, ?, ?)`, p.UserID, p.UserName, p.PhotoID, p.PhotoData, p.PhotoTime, p.LikeNr, p.CommentNr, p.Liked)
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
 
-	if err != nil {
+// GetPhoto returns the photo identified by photoID, or ErrPhotoNotFound if there is no such photo.
+func (db *appdbimpl) GetPhoto(photoID string) (Photo, error) {
+	var p Photo
+	var photoTime int64
+
+	err := db.c.QueryRow(`SELECT p.photo_id, p.user_id, u.user_name, p.blob_key, p.content_type, p.size, p.hash,
+				p.caption, p.photo_time
+			FROM photos p INNER JOIN users u ON u.user_id = p.user_id
+			WHERE p.photo_id = ?`, photoID).Scan(
+		&p.PhotoID, &p.UserID, &p.UserName, &p.BlobKey, &p.ContentType, &p.Size, &p.Hash, &p.Caption, &photoTime)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, ErrPhotoNotFound
+	} else if err != nil {
 		return p, err
 	}
+	p.PhotoTime = time.Unix(photoTime, 0).UTC()
 	return p, nil
 }
 
-func (db *appdbimpl) DeletePhoto(s string) error {
-	_, err_photos := db.c.Exec(`DELETE FROM photos WHERE photo_data=?`, s)
-	if err_photos != nil {
-		return err_photos
+// UploadPhoto saves the metadata of a photo whose content is already in the blob store. The photo identifier is taken
+// from the "photos" sequence, so it's never reused after a deletion, and it's returned with the owner username.
+func (db *appdbimpl) UploadPhoto(p Photo) (Photo, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return p, err
 	}
-	_, err_likes := db.c.Exec(`DELETE FROM likes WHERE photo_data=?`, s)
-	if err_likes != nil {
-		return err_likes
+	defer func() { _ = tx.Rollback() }()
+
+	p.PhotoID, err = nextID(tx, "photos", "Photo")
+	if err != nil {
+		return p, err
 	}
-	_, err_comments := db.c.Exec(`DELETE FROM comments WHERE photo_data=?`, s)
-	if err_comments != nil {
-		return err_comments
+	_, err = tx.Exec(`INSERT INTO photos (photo_id, user_id, blob_key, content_type, size, hash, caption, photo_time)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.PhotoID, p.UserID, p.BlobKey, p.ContentType, p.Size, p.Hash, p.Caption, p.PhotoTime.Unix())
+	if err != nil {
+		return p, err
 	}
 
-	return nil
+	err = tx.QueryRow(`SELECT user_name FROM users WHERE user_id = ?`, p.UserID).Scan(&p.UserName)
+	if err != nil {
+		return p, err
+	}
+	p.PhotoTime = time.Unix(p.PhotoTime.Unix(), 0).UTC()
+
+	return p, tx.Commit()
 }
 
-func (db *appdbimpl) AddLike(l LikeAction) (LikeAction, error) {
-	_, err := db.c.Exec(`INSERT INTO likes (user_id, liked_id, photo_id, like_id)
-			VALUES (?, ?, ?, ?)`, l.UserID, l.LikedID, l.PhotoID, l.LikeID)
+// DeletePhoto deletes the photo identified by photoID, with its likes, comments (and their mentions) and resized
+// copies, or returns ErrPhotoNotFound if there is no such photo. It returns the blob keys of the photo and of its
+// copies, whose content is not removed from the blob store.
+func (db *appdbimpl) DeletePhoto(photoID string) ([]string, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
 
+	var blobKey string
+	err = tx.QueryRow(`SELECT blob_key FROM photos WHERE photo_id = ?`, photoID).Scan(&blobKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPhotoNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var blobKeys = []string{blobKey}
+
+	rows, err := tx.Query(`SELECT blob_key FROM photo_variants WHERE photo_id = ?`, photoID)
 	if err != nil {
-		return l, err
+		return nil, err
+	}
+	for rows.Next() {
+		if err := rows.Scan(&blobKey); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		blobKeys = append(blobKeys, blobKey)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
-	return l, nil
-}
 
-func (db *appdbimpl) RemoveLike(l LikeAction) error {
-	res, err := db.c.Exec(`DELETE FROM likes WHERE like_id=?`, l.LikeID)
+	// The owner photo counter is updated by the triggers
+	for _, query := range []string{
+		`DELETE FROM mentions WHERE comment_id IN (SELECT comment_id FROM comments WHERE photo_id = ?)`,
+		`DELETE FROM comments WHERE photo_id = ?`,
+		`DELETE FROM likes WHERE photo_id = ?`,
+		`DELETE FROM photo_variants WHERE photo_id = ?`,
+		`DELETE FROM photos WHERE photo_id = ?`,
+	} {
+		if _, err := tx.Exec(query, photoID); err != nil {
+			return nil, err
+		}
+	}
+
+	return blobKeys, tx.Commit()
+}
 
+// AddLike records that l.UserID likes the photo l.PhotoID. It reports whether the like is new: liking again is not an
+// error.
+func (db *appdbimpl) AddLike(l LikeAction) (bool, error) {
+	res, err := db.c.Exec(`INSERT INTO likes (photo_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+		l.PhotoID, l.UserID)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	rows_aff, err := res.RowsAffected()
-	if rows_aff == 0 || err != nil {
-		return err
-	}
-	return nil
+	return rows_aff > 0, err
 }
 
-func (db *appdbimpl) AddComment(c CommentAction) (CommentAction, error) {
-	_, err := db.c.Exec(`INSERT INTO comments (user_id, commented_id, photo_id, comment_arr)
-			VALUES (?, ?, ?, ?)`, c.UserID, c.CommentedID, c.PhotoID, c.CommentArr)
+// RemoveLike removes the like of l.UserID to the photo l.PhotoID. Removing a like that doesn't exist is not an error.
+func (db *appdbimpl) RemoveLike(l LikeAction) error {
+	_, err := db.c.Exec(`DELETE FROM likes WHERE photo_id = ? AND user_id = ?`, l.PhotoID, l.UserID)
+	return err
+}
 
+// GetLikers returns a page of the users that liked photoID, the most recent first. Users that banned viewerID are
+// excluded.
+func (db *appdbimpl) GetLikers(viewerID string, photoID string, cursor string, limit int) ([]User, string, error) {
+	after, afterArgs, err := userListCursor(cursor, "l.rowid")
 	if err != nil {
-		return c, err
+		return nil, "", err
 	}
-	return c, nil
-}
 
-func (db *appdbimpl) RemoveComment(s string) error {
-	res, err := db.c.Exec(`DELETE FROM comments WHERE comment_arr=?`, s)
+	args := append([]any{photoID, viewerID}, afterArgs...)
+	rows, err := db.c.Query(`SELECT `+userListColumns+`, l.rowid
+			FROM likes l INNER JOIN users u ON u.user_id = l.user_id
+			WHERE l.photo_id = ?
+				AND `+visibleOwner("u.user_id")+`
+				AND `+after+`
+			ORDER BY l.rowid DESC
+			LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return nil, "", err
+	}
+	return scanUserList(rows, limit)
+}
 
+// AddPhotoVariant saves the metadata of a resized copy of a photo, replacing any previous copy with the same size. The
+// copy is saved only if the photo still has the content photoBlobKey the copy was made from: otherwise (e.g., the photo
+// has been deleted while the copy was generated) it returns ErrPhotoNotFound.
+func (db *appdbimpl) AddPhotoVariant(v PhotoVariant, photoBlobKey string) error {
+	res, err := db.c.Exec(`INSERT OR REPLACE INTO photo_variants (photo_id, size, blob_key, content_type, width, height, bytes, hash)
+			SELECT ?, ?, ?, ?, ?, ?, ?, ? WHERE EXISTS (SELECT 1 FROM photos WHERE photo_id = ? AND blob_key = ?)`,
+		v.PhotoID, v.Size, v.BlobKey, v.ContentType, v.Width, v.Height, v.Bytes, v.Hash, v.PhotoID, photoBlobKey)
 	if err != nil {
 		return err
 	}
 
 	rows_aff, err := res.RowsAffected()
-	if rows_aff == 0 || err != nil {
+	if err != nil {
 		return err
+	} else if rows_aff == 0 {
+		return ErrPhotoNotFound
 	}
 	return nil
 }
+
+// GetPhotoVariant returns the copy of a photo resized to size, or ErrPhotoVariantNotFound if it's not available.
+func (db *appdbimpl) GetPhotoVariant(photoID string, size int) (PhotoVariant, error) {
+	var v PhotoVariant
+	err := db.c.QueryRow(`SELECT photo_id, size, blob_key, content_type, width, height, bytes, hash
+			FROM photo_variants WHERE photo_id = ? AND size = ?`, photoID, size).Scan(
+		&v.PhotoID, &v.Size, &v.BlobKey, &v.ContentType, &v.Width, &v.Height, &v.Bytes, &v.Hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrPhotoVariantNotFound
+	}
+	return v, err
+}
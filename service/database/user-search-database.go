@@ -0,0 +1,74 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+)
+
+// likeEscaper escapes the LIKE wildcards, so they match literally (using `ESCAPE '\'`)
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchUsers returns a page of users whose username contains query, ignoring case. Usernames starting with query
+// come first, then the others; each group is sorted by username. Users that banned searcherID are excluded.
+func (db *appdbimpl) SearchUsers(searcherID string, query string, cursor string, limit int) ([]User, string, error) {
+	fields, err := decodeCursor(cursor, 3)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The sort key is (rank, username, user ID), where rank is 0 for prefix matches and 1 for other matches
+	var after = "true"
+	var afterArgs []any
+	if fields != nil {
+		rank, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		after = "(rank, user_name COLLATE NOCASE, user_id) > (?, ?, ?)"
+		afterArgs = []any{rank, fields[1], fields[2]}
+	}
+
+	// The prefix matches are a separate query, so that they can use the case-insensitive index on the usernames: the
+	// other matches need a scan anyway
+	escaped := likeEscaper.Replace(query)
+	prefix, substring := escaped+"%", "%"+escaped+"%"
+	args := append([]any{prefix, searcherID, substring, prefix, searcherID}, afterArgs...)
+	rows, err := db.c.Query(`SELECT user_id, user_name, photo_nr, followers_nr, following_nr, rank FROM (
+				SELECT u.*, 0 AS rank
+				FROM users u
+				WHERE u.user_name LIKE ? ESCAPE '\'
+					AND `+visibleOwner("u.user_id")+`
+				UNION ALL
+				SELECT u.*, 1 AS rank
+				FROM users u
+				WHERE u.user_name LIKE ? ESCAPE '\'
+					AND u.user_name NOT LIKE ? ESCAPE '\'
+					AND `+visibleOwner("u.user_id")+`
+			)
+			WHERE `+after+`
+			ORDER BY rank, user_name COLLATE NOCASE, user_id
+			LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var users = []User{}
+	var next string
+	var lastRank int
+	for rows.Next() {
+		var u User
+		var rank int
+		if err := rows.Scan(&u.UserID, &u.UserName, &u.PhotoNr, &u.FollowersNr, &u.FollowingNr, &rank); err != nil {
+			return nil, "", err
+		}
+		if len(users) == limit {
+			last := users[len(users)-1]
+			next = encodeCursor(strconv.Itoa(lastRank), last.UserName, last.UserID)
+			break
+		}
+		users = append(users, u)
+		lastRank = rank
+	}
+	return users, next, rows.Err()
+}
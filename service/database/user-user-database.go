@@ -1,49 +1,113 @@
 package database
 
-func (db *appdbimpl) FollowUser(f FollowAction) (FollowAction, error) {
-	_, err := db.c.Exec(`INSERT INTO follows (user_id, followed_id) VALUES (?, ?)`, f.UserID, f.FollowedID)
-
+// FollowUser records that f.UserID follows f.FollowedID. It reports whether the follow is new: following again is
+// not an error. Bans are checked in the same transaction, so a ban can't slip in before the follow is recorded: it
+// returns ErrUserNotFound if f.FollowedID banned f.UserID (banned users can't see them), and ErrFollowBanned if
+// f.UserID banned f.FollowedID.
+func (db *appdbimpl) FollowUser(f FollowAction) (bool, error) {
+	tx, err := db.c.Begin()
 	if err != nil {
-		return f, err
+		return false, err
 	}
+	defer func() { _ = tx.Rollback() }()
 
-	return f, nil
-}
-
-func (db *appdbimpl) UnfollowUser(f FollowAction) error {
-	res, err := db.c.Exec(`DELETE FROM follows WHERE user_id=? AND followed_d=?`, f.UserID, f.FollowedID)
+	var bannedBy, banned bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM bans WHERE user_id = ? AND banned_id = ?),
+				EXISTS (SELECT 1 FROM bans WHERE user_id = ? AND banned_id = ?)`,
+		f.FollowedID, f.UserID, f.UserID, f.FollowedID).Scan(&bannedBy, &banned)
+	if err != nil {
+		return false, err
+	} else if bannedBy {
+		return false, ErrUserNotFound
+	} else if banned {
+		return false, ErrFollowBanned
+	}
 
+	res, err := tx.Exec(`INSERT INTO follows (user_id, followed_id) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+		f.UserID, f.FollowedID)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	rows_aff, err := res.RowsAffected()
-	if rows_aff == 0 || err != nil {
-		return err
+	if err != nil {
+		return false, err
 	}
+	return rows_aff > 0, tx.Commit()
+}
+
+// UnfollowUser removes the follow of f.FollowedID by f.UserID. Removing a follow that doesn't exist is not an error.
+func (db *appdbimpl) UnfollowUser(f FollowAction) error {
+	_, err := db.c.Exec(`DELETE FROM follows WHERE user_id = ? AND followed_id = ?`, f.UserID, f.FollowedID)
 	return err
 }
 
-func (db *appdbimpl) BanUser(b BanAction) (BanAction, error) {
-	_, err := db.c.Exec(`INSERT INTO bans (user_id, banned_id) VALUES (?, ?)`, b.UserID, b.BannedID)
+// GetFollowers returns a page of the users following userID, the most recent first. Users that banned viewerID are
+// excluded.
+func (db *appdbimpl) GetFollowers(viewerID string, userID string, cursor string, limit int) ([]User, string, error) {
+	return db.listFollows(viewerID, userID, "followed_id", "user_id", cursor, limit)
+}
 
+// GetFollowing returns a page of the users followed by userID, the most recent first. Users that banned viewerID are
+// excluded.
+func (db *appdbimpl) GetFollowing(viewerID string, userID string, cursor string, limit int) ([]User, string, error) {
+	return db.listFollows(viewerID, userID, "user_id", "followed_id", cursor, limit)
+}
+
+// listFollows returns a page of the users in the column listed of the follows whose column by is userID. Follows have
+// no time, the row ID gives their order.
+func (db *appdbimpl) listFollows(viewerID string, userID string, by string, listed string, cursor string, limit int) ([]User, string, error) {
+	after, afterArgs, err := userListCursor(cursor, "f.rowid")
 	if err != nil {
-		return b, err
+		return nil, "", err
 	}
 
-	return b, nil
+	args := append([]any{userID, viewerID}, afterArgs...)
+	rows, err := db.c.Query(`SELECT `+userListColumns+`, f.rowid
+			FROM follows f INNER JOIN users u ON u.user_id = f.`+listed+`
+			WHERE f.`+by+` = ?
+				AND `+visibleOwner("u.user_id")+`
+				AND `+after+`
+			ORDER BY f.rowid DESC
+			LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return nil, "", err
+	}
+	return scanUserList(rows, limit)
 }
 
-func (db *appdbimpl) UnbanUser(b BanAction) error {
-	res, err := db.c.Exec(`DELETE FROM follows WHERE user_id=? AND banned_id=?`, b.UserID, b.BannedID)
-
+// BanUser records that b.UserID banned b.BannedID, and removes the follows between them in both directions. It
+// reports whether the ban is new: banning again is not an error.
+func (db *appdbimpl) BanUser(b BanAction) (bool, error) {
+	tx, err := db.c.Begin()
 	if err != nil {
-		return err
+		return false, err
 	}
+	defer func() { _ = tx.Rollback() }()
 
+	res, err := tx.Exec(`INSERT INTO bans (user_id, banned_id) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+		b.UserID, b.BannedID)
+	if err != nil {
+		return false, err
+	}
 	rows_aff, err := res.RowsAffected()
-	if rows_aff == 0 || err != nil {
-		return err
+	if err != nil {
+		return false, err
 	}
+
+	// The follower counters are updated by the triggers
+	_, err = tx.Exec(`DELETE FROM follows WHERE (user_id = ? AND followed_id = ?) OR (user_id = ? AND followed_id = ?)`,
+		b.UserID, b.BannedID, b.BannedID, b.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	return rows_aff > 0, tx.Commit()
+}
+
+// UnbanUser removes the ban of b.BannedID by b.UserID. Removing a ban that doesn't exist is not an error. Follows
+// removed by the ban are not restored.
+func (db *appdbimpl) UnbanUser(b BanAction) error {
+	_, err := db.c.Exec(`DELETE FROM bans WHERE user_id = ? AND banned_id = ?`, b.UserID, b.BannedID)
 	return err
 }
@@ -0,0 +1,19 @@
+package database
+
+// The visibility policy: a user can't see anything of the users that banned them. Their profiles, photos, likes,
+// comments, and their entries in the stream, in follower lists and in search results are hidden, as if they didn't
+// exist. Everybody else, the user included, is visible. Every read path applies it, either with CanSee for a single
+// owner, or with visibleOwner in the queries returning lists.
+
+// visibleOwner returns the SQL condition selecting the rows whose owner, in column, is visible to the viewer. The
+// viewer ID is the query argument of the condition.
+func visibleOwner(column string) string {
+	return column + " NOT IN (SELECT user_id FROM bans WHERE banned_id = ?)"
+}
+
+// CanSee reports whether viewerID can see the information of ownerID, according to the visibility policy
+func (db *appdbimpl) CanSee(viewerID string, ownerID string) (bool, error) {
+	var visible bool
+	err := db.c.QueryRow(`SELECT `+visibleOwner("?"), ownerID, viewerID).Scan(&visible)
+	return visible, err
+}
@@ -0,0 +1,191 @@
+/*
+Package imaging contains the image processing used for photos: decoding, resizing and encoding (using the standard
+library codecs only), and removal of metadata like EXIF and GPS information.
+
+Supported formats for decoding are JPEG, PNG and GIF (first frame only). Resized images are encoded as JPEG if the
+source is a JPEG, as PNG otherwise.
+*/
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// JPEGQuality is the quality used when encoding JPEG images
+const JPEGQuality = 85
+
+// MaxPixels is the maximum number of pixels (width × height) of the images that can be decoded. A decoded image takes
+// 4 bytes per pixel, whatever the size of the encoded one: small files can describe huge images.
+const MaxPixels = 40 * 1000 * 1000
+
+// ErrUnsupportedFormat is returned when the image format can't be decoded
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// ErrTooLarge is returned when the image has more than MaxPixels pixels
+var ErrTooLarge = errors.New("image too large")
+
+// Decode decodes a JPEG, PNG or GIF image, if it's not larger than MaxPixels. The EXIF orientation of JPEG images is
+// applied, so the returned image is oriented as it should be displayed.
+func Decode(data []byte, contentType string) (*image.RGBA, error) {
+	var decodeConfig func(io.Reader) (image.Config, error)
+	var decode func(io.Reader) (image.Image, error)
+	switch contentType {
+	case "image/jpeg":
+		decodeConfig, decode = jpeg.DecodeConfig, jpeg.Decode
+	case "image/png":
+		decodeConfig, decode = png.DecodeConfig, png.Decode
+	case "image/gif":
+		decodeConfig, decode = gif.DecodeConfig, gif.Decode
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	// Check the size in the header first, before allocating the pixels
+	cfg, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if contentType == "image/jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+	return toRGBA(img), nil
+}
+
+// toRGBA returns img as RGBA pixels with the origin in (0, 0), copying it only if needed
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	if rgba, ok := img.(*image.RGBA); ok && b.Min == (image.Point{}) {
+		return rgba
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// Encode writes the image in the format used for images resized from a source with the given content type, and
+// returns the content type of the written image.
+func Encode(w io.Writer, img image.Image, sourceContentType string) (string, error) {
+	if sourceContentType == "image/jpeg" {
+		return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: JPEGQuality})
+	}
+	return "image/png", png.Encode(w, img)
+}
+
+// Fit returns a copy of img scaled down so that its longest side is maxSide pixels. Each pixel of the result is the
+// average of the source pixels it covers (area averaging), which gives good quality when shrinking. Images already
+// fitting are returned at their original size, without copying them if they are RGBA images (like those returned by
+// Decode).
+func Fit(img image.Image, maxSide int) *image.RGBA {
+	b := img.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+	dstW, dstH := srcW, srcH
+	if srcW >= srcH && srcW > maxSide {
+		dstW, dstH = maxSide, srcH*maxSide/srcW
+	} else if srcH > srcW && srcH > maxSide {
+		dstW, dstH = srcW*maxSide/srcH, maxSide
+	}
+	if dstW < 1 {
+		dstW = 1
+	}
+	if dstH < 1 {
+		dstH = 1
+	}
+
+	// Work on premultiplied RGBA pixels, so transparent pixels don't bleed their color
+	src := toRGBA(img)
+	if dstW == srcW && dstH == srcH {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0, y1 := span(y, srcH, dstH)
+		for x := 0; x < dstW; x++ {
+			x0, x1 := span(x, srcW, dstW)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint64(row[i])
+					g += uint64(row[i+1])
+					bl += uint64(row[i+2])
+					a += uint64(row[i+3])
+					n++
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// span returns the range of source pixels [from, to) covered by the destination pixel i.
+func span(i int, srcSize int, dstSize int) (int, int) {
+	from := i * srcSize / dstSize
+	to := (i + 1) * srcSize / dstSize
+	if to <= from {
+		to = from + 1
+	}
+	return from, to
+}
+
+// orient applies the EXIF orientation (1 to 8) to the image.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	src := toRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// Orientations from 5 to 8 swap width and height
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if orientation >= 5 {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirror horizontal
+				dx, dy = w-1-x, y
+			case 3: // Rotate 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirror vertical
+				dx, dy = x, h-1-y
+			case 5: // Transpose
+				dx, dy = y, x
+			case 6: // Rotate 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // Transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotate 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], src.Pix[y*src.Stride+x*4:y*src.Stride+x*4+4])
+		}
+	}
+	return dst
+}
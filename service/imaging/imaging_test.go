@@ -0,0 +1,162 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// labeled returns an image with a pixel for each letter of the rows, whose red component is the letter
+func labeled(rows ...string) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x := range row {
+			img.SetRGBA(x, y, color.RGBA{R: row[x], A: 0xFF})
+		}
+	}
+	return img
+}
+
+// labels returns the rows of letters of an image built by labeled
+func labels(img image.Image) []string {
+	b := img.Bounds()
+	var rows []string
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		var row strings.Builder
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+			row.WriteByte(byte(r >> 8))
+		}
+		rows = append(rows, row.String())
+	}
+	return rows
+}
+
+func TestOrient(t *testing.T) {
+	tests := []struct {
+		orientation int
+		want        []string
+	}{
+		{0, []string{"abc", "def"}},
+		{1, []string{"abc", "def"}},
+		{2, []string{"cba", "fed"}},
+		{3, []string{"fed", "cba"}},
+		{4, []string{"def", "abc"}},
+		{5, []string{"ad", "be", "cf"}},
+		{6, []string{"da", "eb", "fc"}},
+		{7, []string{"fc", "eb", "da"}},
+		{8, []string{"cf", "be", "ad"}},
+		{9, []string{"abc", "def"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.orientation), func(t *testing.T) {
+			got := labels(orient(labeled("abc", "def"), tt.orientation))
+			if strings.Join(got, "/") != strings.Join(tt.want, "/") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeOrientation(t *testing.T) {
+	for orientation := 1; orientation <= 8; orientation++ {
+		t.Run(fmt.Sprint(orientation), func(t *testing.T) {
+			img, err := Decode(testJPEG(t, exifSegment(orientation)), "image/jpeg")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := image.Rect(0, 0, 4, 2)
+			if orientation >= 5 {
+				want = image.Rect(0, 0, 2, 4)
+			}
+			if img.Bounds() != want {
+				t.Errorf("got bounds %v, want %v", img.Bounds(), want)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(4, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		err         bool
+		wantErr     error
+	}{
+		{"PNG", buf.Bytes(), "image/png", false, nil},
+		{"JPEG", testJPEG(t), "image/jpeg", false, nil},
+		{"WebP", testWebP(webpChunk("VP8L", []byte("data"))), "image/webp", true, ErrUnsupportedFormat},
+		{"truncated PNG", buf.Bytes()[:buf.Len()/2], "image/png", true, nil},
+		{"truncated JPEG", testJPEG(t)[:40], "image/jpeg", true, nil},
+		{"wrong content type", buf.Bytes(), "image/jpeg", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := Decode(tt.data, tt.contentType)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && img.Bounds() != image.Rect(0, 0, 4, 2) {
+				t.Errorf("got bounds %v", img.Bounds())
+			}
+		})
+	}
+}
+
+func TestFit(t *testing.T) {
+	checkerboard := labeled("\x00\xFF", "\xFF\x00")
+	offset := testImage(10, 10).SubImage(image.Rect(2, 4, 10, 10))
+
+	tests := []struct {
+		name    string
+		img     image.Image
+		maxSide int
+		want    image.Rectangle
+	}{
+		{"landscape", testImage(800, 600), 400, image.Rect(0, 0, 400, 300)},
+		{"portrait", testImage(600, 800), 400, image.Rect(0, 0, 300, 400)},
+		{"square", testImage(500, 500), 100, image.Rect(0, 0, 100, 100)},
+		{"already fitting", testImage(300, 200), 400, image.Rect(0, 0, 300, 200)},
+		{"exactly fitting", testImage(400, 200), 400, image.Rect(0, 0, 400, 200)},
+		{"thin landscape", testImage(1000, 1), 100, image.Rect(0, 0, 100, 1)},
+		{"thin portrait", testImage(1, 1000), 100, image.Rect(0, 0, 1, 100)},
+		{"averaging", checkerboard, 1, image.Rect(0, 0, 1, 1)},
+		{"origin not in (0, 0)", offset, 4, image.Rect(0, 0, 4, 3)},
+		{"origin not in (0, 0), fitting", offset, 100, image.Rect(0, 0, 8, 6)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Fit(tt.img, tt.maxSide)
+			if got.Bounds() != tt.want {
+				t.Fatalf("got bounds %v, want %v", got.Bounds(), tt.want)
+			}
+			if len(got.Pix) != tt.want.Dx()*tt.want.Dy()*4 {
+				t.Errorf("got %d bytes of pixels, want %d", len(got.Pix), tt.want.Dx()*tt.want.Dy()*4)
+			}
+		})
+	}
+
+	if got := Fit(checkerboard, 1).RGBAAt(0, 0); got != (color.RGBA{R: 0x7F, A: 0xFF}) {
+		t.Errorf("got average %v, want the mean of the pixels", got)
+	}
+	if got := Fit(offset, 100).RGBAAt(0, 0); got != offset.At(2, 4) {
+		t.Errorf("got %v in (0, 0), want the pixel in (2, 4) %v", got, offset.At(2, 4))
+	}
+	if src := testImage(300, 200); Fit(src, 400) != src {
+		t.Errorf("an RGBA image already fitting was copied")
+	}
+}
@@ -0,0 +1,266 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrMalformed is returned when the image structure can't be parsed while removing metadata
+var ErrMalformed = errors.New("malformed image")
+
+// StripMetadata removes metadata (EXIF, XMP, IPTC, text comments) from JPEG, PNG and WebP images without decoding
+// them, so the image data is not re-compressed. The EXIF orientation of JPEG images is kept, as it's needed to display
+// the image correctly. Other formats are returned unchanged.
+func StripMetadata(data []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	default:
+		return data, nil
+	}
+}
+
+// JPEG markers
+const (
+	jpegSOI  = 0xD8
+	jpegSOS  = 0xDA
+	jpegAPP0 = 0xE0
+	jpegAPP1 = 0xE1
+	jpegAPP2 = 0xE2 // ICC color profile
+	jpegAPP4 = 0xE4
+	jpegAPPE = 0xEE // Adobe, needed to decode some color spaces
+	jpegAPPF = 0xEF
+	jpegCOM  = 0xFE
+	jpegTEM  = 0x01
+	jpegRST0 = 0xD0
+	jpegRST7 = 0xD7
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// jpegSegments calls fn for each segment before the image data (Start Of Scan). It returns the offset of the Start Of
+// Scan marker.
+func jpegSegments(data []byte, fn func(marker byte, segment []byte)) (int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != jpegSOI {
+		return 0, ErrMalformed
+	}
+
+	i := 2
+	for i+1 < len(data) {
+		if data[i] != 0xFF {
+			return 0, ErrMalformed
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF: // Fill byte
+			i++
+			continue
+		case marker == jpegSOS:
+			return i, nil
+		case marker == jpegTEM || (marker >= jpegRST0 && marker <= jpegRST7):
+			fn(marker, data[i:i+2])
+			i += 2
+			continue
+		}
+
+		if i+4 > len(data) {
+			return 0, ErrMalformed
+		}
+		// The length includes the length field itself, so it's at least 2
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return 0, ErrMalformed
+		}
+		fn(marker, data[i:end])
+		i = end
+	}
+	return 0, ErrMalformed
+}
+
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 2 {
+		return nil, ErrMalformed
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	out.Write(data[:2])
+
+	orientation := jpegOrientation(data)
+	wroteOrientation := false
+	sos, err := jpegSegments(data, func(marker byte, segment []byte) {
+		switch {
+		case marker == jpegAPP1, marker == jpegCOM, marker >= jpegAPP4 && marker <= jpegAPPF && marker != jpegAPPE:
+			return
+		}
+
+		// The orientation goes right after the JFIF header, or first if there is no JFIF header
+		if !wroteOrientation && marker != jpegAPP0 {
+			writeOrientation(&out, orientation)
+			wroteOrientation = true
+		}
+		out.Write(segment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !wroteOrientation {
+		writeOrientation(&out, orientation)
+	}
+	out.Write(data[sos:])
+	return out.Bytes(), nil
+}
+
+// writeOrientation writes a minimal EXIF segment containing only the orientation tag. Nothing is written for the
+// default orientation.
+func writeOrientation(out *bytes.Buffer, orientation int) {
+	if orientation < 2 || orientation > 8 {
+		return
+	}
+	var tiff = []byte{
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08, // Big endian TIFF header, IFD0 at offset 8
+		0x00, 0x01, // One entry
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, byte(orientation), 0x00, 0x00, // Orientation, SHORT
+		0x00, 0x00, 0x00, 0x00, // No next IFD
+	}
+	out.Write([]byte{0xFF, jpegAPP1})
+	_ = binary.Write(out, binary.BigEndian, uint16(2+len(exifHeader)+len(tiff)))
+	out.Write(exifHeader)
+	out.Write(tiff)
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG image, or 1 (the default) if it's not specified.
+func jpegOrientation(data []byte) int {
+	orientation := 1
+	_, _ = jpegSegments(data, func(marker byte, segment []byte) {
+		if marker == jpegAPP1 && len(segment) >= 4 && bytes.HasPrefix(segment[4:], exifHeader) {
+			orientation = exifOrientation(segment[4+len(exifHeader):])
+		}
+	})
+	return orientation
+}
+
+// exifOrientation reads the orientation tag from the first IFD of a TIFF structure (the content of an EXIF segment).
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8:]))
+			if value < 1 || value > 8 {
+				return 1
+			}
+			return value
+		}
+	}
+	return 1
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadataChunks lists the PNG chunks removed by stripPNG
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrMalformed
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	out.Write(pngSignature)
+
+	// Each chunk is made of length (4 bytes), type (4 bytes), data and CRC (4 bytes)
+	for i := len(pngSignature); i < len(data); {
+		if i+12 > len(data) {
+			return nil, ErrMalformed
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i {
+			return nil, ErrMalformed
+		}
+		if !pngMetadataChunks[string(data[i+4:i+8])] {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	return out.Bytes(), nil
+}
+
+// WebP extended format (VP8X) flags
+const (
+	webpFlagXMP  = 0x04
+	webpFlagEXIF = 0x08
+)
+
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrMalformed
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	out.Write(data[:12])
+
+	// Each chunk is made of FourCC (4 bytes), little endian size (4 bytes) and data, padded to an even size
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrMalformed
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2
+		if end > len(data) || end < i {
+			return nil, ErrMalformed
+		}
+
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	// Update the RIFF size, which doesn't include the first 8 bytes
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:], uint32(len(stripped)-8))
+	return stripped, nil
+}
@@ -0,0 +1,403 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testImage returns a w×h image where each pixel has a different color
+func testImage(w int, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 40), G: uint8(y * 40), B: 0x80, A: 0xFF})
+		}
+	}
+	return img
+}
+
+// jpegSegment returns a JPEG segment with the marker and the payload, including the length field
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(2+len(payload)))
+	return append(segment, payload...)
+}
+
+// exifTIFF returns a TIFF structure with an IFD containing a dummy tag and the orientation tag (omitted if 0)
+func exifTIFF(order binary.AppendByteOrder, orientation int) []byte {
+	var tiff []byte
+	if order == binary.LittleEndian {
+		tiff = []byte("II\x2A\x00")
+	} else {
+		tiff = []byte("MM\x00\x2A")
+	}
+	tiff = order.AppendUint32(tiff, 8)
+
+	entries := [][3]uint16{{0x010F, 2, 0}} // Make, a tag before the orientation
+	if orientation != 0 {
+		entries = append(entries, [3]uint16{0x0112, 3, uint16(orientation)})
+	}
+	tiff = order.AppendUint16(tiff, uint16(len(entries)))
+	for _, e := range entries {
+		tiff = order.AppendUint16(tiff, e[0])
+		tiff = order.AppendUint16(tiff, e[1])
+		tiff = order.AppendUint32(tiff, 1)
+		tiff = order.AppendUint16(tiff, e[2])
+		tiff = order.AppendUint16(tiff, 0)
+	}
+	return order.AppendUint32(tiff, 0)
+}
+
+// exifSegment returns an APP1 segment with the orientation and a fake GPS payload
+func exifSegment(orientation int) []byte {
+	payload := append(append([]byte(nil), exifHeader...), exifTIFF(binary.LittleEndian, orientation)...)
+	return jpegSegment(jpegAPP1, append(payload, "GPS 45.4642N 9.1900E"...))
+}
+
+// testJPEG encodes a small JPEG and inserts the segments right after the Start Of Image marker
+func testJPEG(t *testing.T, segments ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(4, 2), nil); err != nil {
+		t.Fatal(err)
+	}
+	out := append([]byte(nil), buf.Bytes()[:2]...)
+	for _, s := range segments {
+		out = append(out, s...)
+	}
+	return append(out, buf.Bytes()[2:]...)
+}
+
+// pngChunk returns a PNG chunk with a valid CRC
+func pngChunk(typ string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(append(chunk, typ...), data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// testPNG encodes a small PNG and inserts the chunks right after the IHDR chunk
+func testPNG(t *testing.T, chunks ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(4, 2)); err != nil {
+		t.Fatal(err)
+	}
+	ihdrEnd := len(pngSignature) + 12 + 13
+	out := append([]byte(nil), buf.Bytes()[:ihdrEnd]...)
+	for _, c := range chunks {
+		out = append(out, c...)
+	}
+	return append(out, buf.Bytes()[ihdrEnd:]...)
+}
+
+// webpChunk returns a RIFF chunk, padded to an even size
+func webpChunk(fourCC string, data []byte) []byte {
+	chunk := binary.LittleEndian.AppendUint32([]byte(fourCC), uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// testWebP returns a WebP file made of the chunks. The image data is not valid, as only the container is parsed.
+func testWebP(chunks ...[]byte) []byte {
+	var body []byte
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	out := binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(4+len(body)))
+	return append(append(out, "WEBP"...), body...)
+}
+
+// vp8x returns the data of a VP8X chunk with the flags, for a 4×2 image
+func vp8x(flags byte) []byte {
+	return []byte{flags, 0, 0, 0, 3, 0, 0, 1, 0, 0}
+}
+
+func TestJPEGSegments(t *testing.T) {
+	valid := testJPEG(t, jpegSegment(jpegAPP0, []byte("JFIF\x00")), jpegSegment(jpegCOM, []byte("comment")))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		markers []byte // Leading markers expected, the encoder ones follow
+		err     error
+	}{
+		{"valid", valid, []byte{jpegAPP0, jpegCOM}, nil},
+		{"fill bytes", []byte{0xFF, jpegSOI, 0xFF, 0xFF, 0xFF, jpegCOM, 0x00, 0x02, 0xFF, jpegSOS}, []byte{jpegCOM}, nil},
+		{"restart markers", []byte{0xFF, jpegSOI, 0xFF, jpegRST0, 0xFF, jpegTEM, 0xFF, jpegSOS}, []byte{jpegRST0, jpegTEM}, nil},
+		{"empty", nil, nil, ErrMalformed},
+		{"no SOI", []byte{0x00, 0x00, 0xFF, jpegSOS}, nil, ErrMalformed},
+		{"only SOI", []byte{0xFF, jpegSOI}, nil, ErrMalformed},
+		{"no SOS", []byte{0xFF, jpegSOI, 0xFF, jpegCOM, 0x00, 0x02}, nil, ErrMalformed},
+		{"garbage between segments", []byte{0xFF, jpegSOI, 0x12, 0x34, 0xFF, jpegSOS}, nil, ErrMalformed},
+		{"truncated length", []byte{0xFF, jpegSOI, 0xFF, jpegCOM, 0x00}, nil, ErrMalformed},
+		{"truncated segment", []byte{0xFF, jpegSOI, 0xFF, jpegCOM, 0x00, 0x08, 'a', 'b'}, nil, ErrMalformed},
+		{"length 0", []byte{0xFF, jpegSOI, 0xFF, jpegCOM, 0x00, 0x00, 0xFF, jpegSOS}, nil, ErrMalformed},
+		{"length 1", []byte{0xFF, jpegSOI, 0xFF, jpegCOM, 0x00, 0x01, 0xFF, jpegSOS}, nil, ErrMalformed},
+		{"length past the end", []byte{0xFF, jpegSOI, 0xFF, jpegCOM, 0xFF, 0xFF, 0xFF, jpegSOS}, nil, ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var markers []byte
+			sos, err := jpegSegments(tt.data, func(marker byte, segment []byte) {
+				if segment[0] != 0xFF || segment[1] != marker {
+					t.Errorf("segment of marker %#x starts with %#x %#x", marker, segment[0], segment[1])
+				}
+				markers = append(markers, marker)
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !bytes.HasPrefix(markers, tt.markers) {
+				t.Errorf("got markers %x, want them to start with %x", markers, tt.markers)
+			}
+			if tt.data[sos] != 0xFF || tt.data[sos+1] != jpegSOS {
+				t.Errorf("offset %d is not the Start Of Scan", sos)
+			}
+		})
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	type test struct {
+		name string
+		tiff []byte
+		want int
+	}
+	var tests []test
+	for orientation := 1; orientation <= 8; orientation++ {
+		tests = append(tests,
+			test{fmt.Sprint("little endian ", orientation), exifTIFF(binary.LittleEndian, orientation), orientation},
+			test{fmt.Sprint("big endian ", orientation), exifTIFF(binary.BigEndian, orientation), orientation},
+		)
+	}
+
+	truncatedIFD := exifTIFF(binary.BigEndian, 0)
+	binary.BigEndian.PutUint16(truncatedIFD[8:], 40)
+	badOffset := exifTIFF(binary.LittleEndian, 6)
+	binary.LittleEndian.PutUint32(badOffset[4:], 0xFFFFFFF0)
+	lowOffset := exifTIFF(binary.LittleEndian, 6)
+	binary.LittleEndian.PutUint32(lowOffset[4:], 2)
+
+	tests = append(tests,
+		test{"empty", nil, 1},
+		test{"short", []byte("II\x2A\x00"), 1},
+		test{"bad byte order", append([]byte("XX"), exifTIFF(binary.BigEndian, 6)[2:]...), 1},
+		test{"no orientation tag", exifTIFF(binary.BigEndian, 0), 1},
+		test{"orientation 256", exifTIFF(binary.BigEndian, 0x100), 1},
+		test{"orientation 9", exifTIFF(binary.LittleEndian, 9), 1},
+		test{"entries past the end", truncatedIFD, 1},
+		test{"IFD offset past the end", badOffset, 1},
+		test{"IFD offset inside the header", lowOffset, 1},
+		test{"truncated IFD", exifTIFF(binary.LittleEndian, 6)[:20], 1},
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exifOrientation(tt.tiff); got != tt.want {
+				t.Errorf("got orientation %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripJPEG(t *testing.T) {
+	jfif := jpegSegment(jpegAPP0, []byte("JFIF\x00\x01\x02\x00\x00\x01\x00\x01\x00\x00"))
+	icc := jpegSegment(jpegAPP2, []byte("ICC_PROFILE\x00"))
+	adobe := jpegSegment(jpegAPPE, []byte("Adobe"))
+	comment := jpegSegment(jpegCOM, []byte("secret comment"))
+	iptc := jpegSegment(0xED, []byte("Photoshop 3.0\x00secret IPTC"))
+	xmp := jpegSegment(jpegAPP1, []byte("http://ns.adobe.com/xap/1.0/\x00secret XMP"))
+
+	type test struct {
+		name        string
+		data        []byte
+		orientation int
+		kept        [][]byte
+	}
+	tests := []test{
+		{"no metadata", testJPEG(t), 1, nil},
+		{"JFIF and EXIF", testJPEG(t, jfif, exifSegment(1), comment), 1, [][]byte{jfif}},
+		{"all kinds", testJPEG(t, jfif, exifSegment(3), xmp, iptc, comment, icc, adobe), 3, [][]byte{jfif, icc, adobe}},
+		{"EXIF first", testJPEG(t, exifSegment(6), icc), 6, [][]byte{icc}},
+	}
+	for orientation := 1; orientation <= 8; orientation++ {
+		data := testJPEG(t, jfif, exifSegment(orientation))
+		tests = append(tests, test{fmt.Sprint("orientation ", orientation), data, orientation, [][]byte{jfif}})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := StripMetadata(tt.data, "image/jpeg")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+				t.Fatalf("can't decode the stripped image: %v", err)
+			}
+			for _, secret := range []string{"secret", "GPS", "xap"} {
+				if bytes.Contains(out, []byte(secret)) {
+					t.Errorf("the stripped image still contains %q", secret)
+				}
+			}
+			for _, segment := range tt.kept {
+				if !bytes.Contains(out, segment) {
+					t.Errorf("segment %q was removed", segment[4:])
+				}
+			}
+			if got := jpegOrientation(out); got != tt.orientation {
+				t.Errorf("got orientation %d, want %d", got, tt.orientation)
+			}
+
+			var app1 int
+			_, _ = jpegSegments(out, func(marker byte, _ []byte) {
+				if marker == jpegAPP1 {
+					app1++
+				}
+			})
+			if want := map[bool]int{true: 0, false: 1}[tt.orientation == 1]; app1 != want {
+				t.Errorf("got %d APP1 segments, want %d", app1, want)
+			}
+		})
+	}
+}
+
+func TestStripPNG(t *testing.T) {
+	plain := testPNG(t)
+	withMetadata := testPNG(t,
+		pngChunk("tEXt", []byte("Comment\x00secret text")),
+		pngChunk("zTXt", []byte("Comment\x00\x00secret zip")),
+		pngChunk("iTXt", []byte("Comment\x00\x00\x00\x00\x00secret intl")),
+		pngChunk("eXIf", exifTIFF(binary.BigEndian, 6)),
+		pngChunk("tIME", []byte{0x07, 0xE6, 1, 2, 3, 4, 5}),
+		pngChunk("gAMA", []byte{0, 1, 0x86, 0xA0}),
+	)
+	bogusLength := append([]byte(nil), withMetadata...)
+	binary.BigEndian.PutUint32(bogusLength[len(pngSignature)+25:], 0xFFFFFFFF)
+
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+		err  error
+	}{
+		{"no metadata", plain, plain, nil},
+		{"metadata", withMetadata, testPNG(t, pngChunk("gAMA", []byte{0, 1, 0x86, 0xA0})), nil},
+		{"empty", nil, nil, ErrMalformed},
+		{"bad signature", append([]byte("\x89PNX\r\n\x1a\n"), plain[8:]...), nil, ErrMalformed},
+		{"truncated chunk header", plain[:len(pngSignature)+6], nil, ErrMalformed},
+		{"truncated chunk", plain[:len(plain)-1], nil, ErrMalformed},
+		{"bogus length", bogusLength, nil, ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := StripMetadata(tt.data, "image/png")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !bytes.Equal(out, tt.want) {
+				t.Errorf("the stripped image differs from the expected one")
+			}
+			if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+				t.Errorf("can't decode the stripped image: %v", err)
+			}
+			for chunk := range pngMetadataChunks {
+				if bytes.Contains(out, []byte(chunk)) {
+					t.Errorf("the stripped image still contains a %s chunk", chunk)
+				}
+			}
+		})
+	}
+}
+
+func TestStripWebP(t *testing.T) {
+	vp8l := webpChunk("VP8L", []byte("image data"))
+	odd := webpChunk("ICCP", []byte("odd"))
+	exif := webpChunk("EXIF", append([]byte(nil), exifTIFF(binary.LittleEndian, 6)...))
+	xmp := webpChunk("XMP ", []byte("<x:xmpmeta>secret</x:xmpmeta>"))
+
+	bogusSize := testWebP(webpChunk("VP8X", vp8x(webpFlagEXIF)), vp8l)
+	binary.LittleEndian.PutUint32(bogusSize[16:], 0xFFFFFFF0)
+
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+		err  error
+	}{
+		{"simple format", testWebP(vp8l), testWebP(vp8l), nil},
+		{
+			"extended format",
+			testWebP(webpChunk("VP8X", vp8x(0x20|webpFlagEXIF|webpFlagXMP)), odd, vp8l, exif, xmp),
+			testWebP(webpChunk("VP8X", vp8x(0x20)), odd, vp8l),
+			nil,
+		},
+		{"empty", nil, nil, ErrMalformed},
+		{"not RIFF", append([]byte("RIFX"), testWebP(vp8l)[4:]...), nil, ErrMalformed},
+		{"not WebP", append(append([]byte("RIFF\x00\x00\x00\x00"), "WAVE"...), vp8l...), nil, ErrMalformed},
+		{"truncated chunk header", testWebP(vp8l)[:16], nil, ErrMalformed},
+		{"truncated chunk", testWebP(vp8l)[:24], nil, ErrMalformed},
+		{"bogus size", bogusSize, nil, ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := StripMetadata(tt.data, "image/webp")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !bytes.Equal(out, tt.want) {
+				t.Errorf("got %q, want %q", out, tt.want)
+			}
+			if size := binary.LittleEndian.Uint32(out[4:]); int(size) != len(out)-8 {
+				t.Errorf("got RIFF size %d, want %d", size, len(out)-8)
+			}
+		})
+	}
+}
+
+// TestStripMetadataCorrupted checks that truncated and corrupted images are rejected (or returned stripped) without
+// panicking.
+func TestStripMetadataCorrupted(t *testing.T) {
+	tests := []struct {
+		contentType string
+		data        []byte
+	}{
+		{"image/jpeg", testJPEG(t, exifSegment(6), jpegSegment(jpegCOM, []byte("comment")))},
+		{"image/png", testPNG(t, pngChunk("tEXt", []byte("Comment\x00text")))},
+		{"image/webp", testWebP(webpChunk("VP8X", vp8x(webpFlagEXIF)), webpChunk("VP8L", []byte("data")), webpChunk("EXIF", []byte("exif")))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			// Cap the prefixes, so reading past their end panics instead of reading the rest of the image
+			for n := 0; n < len(tt.data); n++ {
+				_, _ = StripMetadata(tt.data[:n:n], tt.contentType)
+			}
+			for i := range tt.data {
+				for _, b := range []byte{0x00, 0x01, 0x7F, 0xFF} {
+					corrupted := append([]byte(nil), tt.data...)
+					corrupted[i] = b
+					_, _ = StripMetadata(corrupted, tt.contentType)
+				}
+			}
+		})
+	}
+}
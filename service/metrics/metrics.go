@@ -0,0 +1,348 @@
+/*
+Package metrics collects application metrics and exposes them in the Prometheus text format (version 0.0.4), so that
+they can be scraped by Prometheus without depending on its client library.
+
+Only the metric types used by this project are supported: counters, gauges and histograms, optionally with labels, and
+counters and gauges whose value is read at scrape time from a function.
+
+To use this package, create a Registry, create the metrics in it, and serve Registry.Handler (e.g., at /metrics):
+
+	reg := metrics.NewRegistry()
+	requests := reg.NewCounterVec("http_requests_total", "Requests handled.", "method", "status")
+
+	// In a handler or middleware
+	requests.Add(1, r.Method, "200")
+
+Metrics can be created at any time, but names must be unique: creating two metrics with the same name panics (like
+expvar.Publish). The same happens when the number of label values doesn't match the number of label names.
+*/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of the histogram buckets suited for HTTP request latencies, in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry is a set of metrics, exposed together
+type Registry struct {
+	mu       sync.Mutex
+	metrics  map[string]metric
+	onScrape []func()
+}
+
+// metric is a metric family, able to write its samples in the text format
+type metric interface {
+	kind() string
+	help() string
+	write(w io.Writer, name string)
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]metric{}}
+}
+
+func (reg *Registry) register(name string, m metric) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if _, ok := reg.metrics[name]; ok {
+		panic(fmt.Sprintf("metrics: duplicate metric name %q", name))
+	}
+	reg.metrics[name] = m
+}
+
+// OnScrape registers fn to be called before each scrape. It's useful to update several gauges from a source that is
+// expensive to read once per value (e.g., a database query).
+func (reg *Registry) OnScrape(fn func()) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.onScrape = append(reg.onScrape, fn)
+}
+
+// Handler returns an HTTP handler replying with all the metrics of the registry, in the text format
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		reg.Expose(w)
+	})
+}
+
+// Expose writes all the metrics of the registry to w in the text format, sorted by name
+func (reg *Registry) Expose(w io.Writer) {
+	reg.mu.Lock()
+	var hooks = append([]func(){}, reg.onScrape...)
+	var names = make([]string, 0, len(reg.metrics))
+	for name := range reg.metrics {
+		names = append(names, name)
+	}
+	var metrics = make(map[string]metric, len(reg.metrics))
+	for name, m := range reg.metrics {
+		metrics[name] = m
+	}
+	reg.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn()
+	}
+
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		m := metrics[name]
+		_, _ = fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(m.help()), name, m.kind())
+		m.write(bw, name)
+	}
+	_ = bw.Flush()
+}
+
+// desc is the description of a metric family, shared by all the types
+type desc struct {
+	typ    string
+	doc    string
+	labels []string
+}
+
+func (d desc) kind() string { return d.typ }
+func (d desc) help() string { return d.doc }
+
+// seriesKey returns the key identifying the series with the given label values
+func (d desc) seriesKey(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %d label values given for %d labels", len(labelValues), len(d.labels)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// formatLabels returns the labels of a sample, like `{method="GET",status="200"}`, with the extra label (e.g., the
+// bucket upper bound `le`) if extraName is not empty
+func (d desc) formatLabels(labelValues []string, extraName string, extraValue string) string {
+	if len(d.labels) == 0 && extraName == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range d.labels {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name + `="` + escapeLabel(labelValues[i]) + `"`)
+	}
+	if extraName != "" {
+		if len(d.labels) > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(extraName + `="` + escapeLabel(extraValue) + `"`)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// CounterVec is a counter, partitioned by labels. Counters only go up.
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// NewCounterVec creates a counter with the given label names (none for a plain counter)
+func (reg *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{typ: "counter", doc: help, labels: labels}, series: map[string]*counterSeries{}}
+	reg.register(name, c)
+	return c
+}
+
+// Add adds delta, which must not be negative, to the counter with the given label values
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counters can't decrease")
+	}
+	key := c.seriesKey(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{labelValues: append([]string{}, labelValues...)}
+		c.series[key] = s
+	}
+	s.value += delta
+}
+
+func (c *CounterVec) write(w io.Writer, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Sorted, so that the output is stable between scrapes
+	keys := make([]string, 0, len(c.series))
+	for key := range c.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := c.series[key]
+		_, _ = fmt.Fprintf(w, "%s%s %s\n", name, c.formatLabels(s.labelValues, "", ""), formatValue(s.value))
+	}
+}
+
+// Gauge is a value that can go up and down (e.g., the requests in progress)
+type Gauge struct {
+	desc
+	mu    sync.Mutex
+	value float64
+}
+
+// NewGauge creates a gauge, initially zero
+func (reg *Registry) NewGauge(name string, help string) *Gauge {
+	g := &Gauge{desc: desc{typ: "gauge", doc: help}}
+	reg.register(name, g)
+	return g
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	g.value = v
+	g.mu.Unlock()
+}
+
+// Add adds delta, which can be negative, to the gauge
+func (g *Gauge) Add(delta float64) {
+	g.mu.Lock()
+	g.value += delta
+	g.mu.Unlock()
+}
+
+func (g *Gauge) write(w io.Writer, name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, _ = fmt.Fprintf(w, "%s %s\n", name, formatValue(g.value))
+}
+
+// funcMetric is a counter or a gauge whose value is read at scrape time
+type funcMetric struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc creates a gauge whose value is returned by fn at each scrape
+func (reg *Registry) NewGaugeFunc(name string, help string, fn func() float64) {
+	reg.register(name, &funcMetric{desc: desc{typ: "gauge", doc: help}, fn: fn})
+}
+
+// NewCounterFunc creates a counter whose value is returned by fn at each scrape (e.g., a counter kept by a library)
+func (reg *Registry) NewCounterFunc(name string, help string, fn func() float64) {
+	reg.register(name, &funcMetric{desc: desc{typ: "counter", doc: help}, fn: fn})
+}
+
+func (f *funcMetric) write(w io.Writer, name string) {
+	_, _ = fmt.Fprintf(w, "%s %s\n", name, formatValue(f.fn()))
+}
+
+// HistogramVec counts observations (e.g., request durations) in buckets, partitioned by labels
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+
+	// counts are the observations in each bucket (not cumulative); the last one is the +Inf bucket
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec creates a histogram with the given bucket upper bounds (in increasing order, without +Inf) and label
+// names
+func (reg *Registry) NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: histogram buckets must be sorted")
+	}
+	h := &HistogramVec{
+		desc:    desc{typ: "histogram", doc: help, labels: labels},
+		buckets: buckets,
+		series:  map[string]*histogramSeries{},
+	}
+	reg.register(name, h)
+	return h
+}
+
+// Observe adds the observation v to the histogram with the given label values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := h.seriesKey(labelValues)
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			labelValues: append([]string{}, labelValues...),
+			counts:      make([]uint64, len(h.buckets)+1),
+		}
+		h.series[key] = s
+	}
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+func (h *HistogramVec) write(w io.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = formatValue(h.buckets[i])
+			}
+			_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", name, h.formatLabels(s.labelValues, "le", le), cumulative)
+		}
+		labels := h.formatLabels(s.labelValues, "", "")
+		_, _ = fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatValue(s.sum))
+		_, _ = fmt.Fprintf(w, "%s_count%s %d\n", name, labels, s.count)
+	}
+}
+
+// formatValue formats a sample value as expected by Prometheus
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
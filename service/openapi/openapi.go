@@ -0,0 +1,298 @@
+/*
+Package openapi validates HTTP requests and responses against an OpenAPI 3 specification.
+
+Only the parts of the specification used by this project are supported: path and query parameters, JSON request and
+response bodies, and schemas with types, lengths, ranges, patterns, enums, formats, required properties, arrays and
+allOf. References (`$ref`) are supported within the same document.
+
+To use this package, load the specification with Load (at startup, so that errors in the specification stop the
+server), then check the requests with Spec.ValidateRequest:
+
+	spec, err := openapi.Load(doc.OpenAPI)
+	if err != nil {
+		return fmt.Errorf("loading the OpenAPI specification: %w", err)
+	}
+
+	// In a handler or middleware
+	if err := spec.ValidateRequest(r); err != nil {
+		// err is a *openapi.ValidationError, listing all the violated constraints
+	}
+
+Requests for paths and methods not in the specification are not validated.
+*/
+package openapi
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Spec is a loaded OpenAPI specification
+type Spec struct {
+	doc    document
+	routes []route
+
+	// patterns are the compiled schema patterns, by source
+	patterns map[string]*regexp.Regexp
+}
+
+type document struct {
+	Paths      map[string]*pathItem `yaml:"paths"`
+	Components struct {
+		Parameters map[string]*parameter `yaml:"parameters"`
+		Schemas    map[string]*schema    `yaml:"schemas"`
+		Responses  map[string]*response  `yaml:"responses"`
+	} `yaml:"components"`
+}
+
+type pathItem struct {
+	Parameters []*parameter `yaml:"parameters"`
+	Get        *operation   `yaml:"get"`
+	Put        *operation   `yaml:"put"`
+	Post       *operation   `yaml:"post"`
+	Delete     *operation   `yaml:"delete"`
+	Patch      *operation   `yaml:"patch"`
+}
+
+type operation struct {
+	Parameters  []*parameter         `yaml:"parameters"`
+	RequestBody *requestBody         `yaml:"requestBody"`
+	Responses   map[string]*response `yaml:"responses"`
+}
+
+type parameter struct {
+	Ref      string  `yaml:"$ref"`
+	Name     string  `yaml:"name"`
+	In       string  `yaml:"in"`
+	Required bool    `yaml:"required"`
+	Schema   *schema `yaml:"schema"`
+}
+
+type requestBody struct {
+	Required bool                  `yaml:"required"`
+	Content  map[string]*mediaType `yaml:"content"`
+}
+
+type response struct {
+	Ref     string                `yaml:"$ref"`
+	Content map[string]*mediaType `yaml:"content"`
+}
+
+type mediaType struct {
+	Schema *schema `yaml:"schema"`
+}
+
+type schema struct {
+	Ref                  string             `yaml:"$ref"`
+	Type                 string             `yaml:"type"`
+	Format               string             `yaml:"format"`
+	Pattern              string             `yaml:"pattern"`
+	Enum                 []interface{}      `yaml:"enum"`
+	MinLength            *int               `yaml:"minLength"`
+	MaxLength            *int               `yaml:"maxLength"`
+	Minimum              *float64           `yaml:"minimum"`
+	Maximum              *float64           `yaml:"maximum"`
+	MinItems             *int               `yaml:"minItems"`
+	MaxItems             *int               `yaml:"maxItems"`
+	Required             []string           `yaml:"required"`
+	Properties           map[string]*schema `yaml:"properties"`
+	AdditionalProperties *bool              `yaml:"additionalProperties"`
+	Items                *schema            `yaml:"items"`
+	AllOf                []*schema          `yaml:"allOf"`
+	Nullable             bool               `yaml:"nullable"`
+	ReadOnly             bool               `yaml:"readOnly"`
+}
+
+// route is an operation with the path template split in segments; parameters segments are like `{name}`
+type route struct {
+	method   string
+	segments []string
+	params   []*parameter
+	op       *operation
+}
+
+// Load parses an OpenAPI specification in YAML. It fails if the specification has references to missing components,
+// or invalid patterns.
+func Load(spec []byte) (*Spec, error) {
+	var s = Spec{patterns: map[string]*regexp.Regexp{}}
+	if err := yaml.Unmarshal(spec, &s.doc); err != nil {
+		return nil, fmt.Errorf("parsing the specification: %w", err)
+	}
+
+	for path, item := range s.doc.Paths {
+		for method, op := range map[string]*operation{
+			http.MethodGet:    item.Get,
+			http.MethodPut:    item.Put,
+			http.MethodPost:   item.Post,
+			http.MethodDelete: item.Delete,
+			http.MethodPatch:  item.Patch,
+		} {
+			if op == nil {
+				continue
+			}
+			params, err := s.operationParameters(item, op)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			if err := s.check(op, params); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			s.routes = append(s.routes, route{
+				method:   method,
+				segments: strings.Split(strings.Trim(path, "/"), "/"),
+				params:   params,
+				op:       op,
+			})
+		}
+	}
+	return &s, nil
+}
+
+// operationParameters returns the parameters of the operation, including those declared for the whole path (unless
+// the operation overrides them). References are resolved.
+func (s *Spec) operationParameters(item *pathItem, op *operation) ([]*parameter, error) {
+	var params []*parameter
+	var index = map[string]int{}
+	for _, p := range append(append([]*parameter{}, item.Parameters...), op.Parameters...) {
+		if p.Ref != "" {
+			name := strings.TrimPrefix(p.Ref, "#/components/parameters/")
+			if p = s.doc.Components.Parameters[name]; p == nil {
+				return nil, fmt.Errorf("unknown parameter reference %q", name)
+			}
+		}
+		key := p.In + " " + p.Name
+		if i, ok := index[key]; ok {
+			params[i] = p
+		} else {
+			index[key] = len(params)
+			params = append(params, p)
+		}
+	}
+	return params, nil
+}
+
+// check verifies that the references in the operation can be resolved, and compiles the patterns
+func (s *Spec) check(op *operation, params []*parameter) error {
+	var seen = map[*schema]bool{}
+	for _, p := range params {
+		if err := s.checkSchema(p.Schema, seen); err != nil {
+			return fmt.Errorf("parameter %q: %w", p.Name, err)
+		}
+	}
+	if op.RequestBody != nil {
+		for _, mt := range op.RequestBody.Content {
+			if err := s.checkSchema(mt.Schema, seen); err != nil {
+				return fmt.Errorf("request body: %w", err)
+			}
+		}
+	}
+	for status, resp := range op.Responses {
+		resp, err := s.resolveResponse(resp)
+		if err != nil {
+			return fmt.Errorf("response %s: %w", status, err)
+		}
+		for _, mt := range resp.Content {
+			if err := s.checkSchema(mt.Schema, seen); err != nil {
+				return fmt.Errorf("response %s: %w", status, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Spec) checkSchema(sc *schema, seen map[*schema]bool) error {
+	sc, err := s.resolveSchema(sc)
+	if err != nil || sc == nil || seen[sc] {
+		return err
+	}
+	seen[sc] = true
+
+	if sc.Pattern != "" && s.patterns[sc.Pattern] == nil {
+		re, err := regexp.Compile(sc.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+		s.patterns[sc.Pattern] = re
+	}
+	for _, sub := range sc.Properties {
+		if err := s.checkSchema(sub, seen); err != nil {
+			return err
+		}
+	}
+	for _, sub := range sc.AllOf {
+		if err := s.checkSchema(sub, seen); err != nil {
+			return err
+		}
+	}
+	return s.checkSchema(sc.Items, seen)
+}
+
+// resolveSchema follows the reference of sc, if any
+func (s *Spec) resolveSchema(sc *schema) (*schema, error) {
+	for sc != nil && sc.Ref != "" {
+		name := strings.TrimPrefix(sc.Ref, "#/components/schemas/")
+		if sc = s.doc.Components.Schemas[name]; sc == nil {
+			return nil, fmt.Errorf("unknown schema reference %q", name)
+		}
+	}
+	return sc, nil
+}
+
+// resolveResponse follows the reference of resp, if any
+func (s *Spec) resolveResponse(resp *response) (*response, error) {
+	for resp != nil && resp.Ref != "" {
+		name := strings.TrimPrefix(resp.Ref, "#/components/responses/")
+		if resp = s.doc.Components.Responses[name]; resp == nil {
+			return nil, fmt.Errorf("unknown response reference %q", name)
+		}
+	}
+	return resp, nil
+}
+
+// findRoute returns the route matching the request method and path, with the values of the path parameters. Routes
+// with more literal segments win over routes with parameters in their place. It returns nil if no route matches.
+func (s *Spec) findRoute(method string, path string) (*route, map[string]string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	var best *route
+	var bestLiterals = -1
+	for i := range s.routes {
+		rt := &s.routes[i]
+		if rt.method != method || len(rt.segments) != len(segments) {
+			continue
+		}
+
+		literals := 0
+		for j, seg := range rt.segments {
+			if isTemplate(seg) {
+				continue
+			} else if seg != segments[j] {
+				literals = -1
+				break
+			}
+			literals++
+		}
+		if literals > bestLiterals {
+			best, bestLiterals = rt, literals
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+
+	var values = map[string]string{}
+	for j, seg := range best.segments {
+		if isTemplate(seg) {
+			values[seg[1:len(seg)-1]] = segments[j]
+		}
+	}
+	return best, values
+}
+
+// isTemplate reports whether a path segment is a parameter, like `{user_id}`
+func isTemplate(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
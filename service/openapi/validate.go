@@ -0,0 +1,410 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxBodySize is the maximum size of the JSON bodies that are validated
+const maxBodySize = 1 << 20
+
+// uuidPattern matches the textual representation of UUIDs (the `uuid` format)
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Violation is a constraint of the specification that is not respected
+type Violation struct {
+	// In is where the invalid value is: "path", "query", "body" or "response"
+	In string `json:"in"`
+
+	// Field is the name of the parameter, or the path of the property in the body (e.g., "replies[0].user_id"). It's
+	// empty for the whole body.
+	Field string `json:"field"`
+
+	// Message describes the violated constraint
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	if v.Field == "" {
+		return v.In + ": " + v.Message
+	}
+	return v.In + " " + v.Field + ": " + v.Message
+}
+
+// ValidationError is the error of a request that does not respect the specification
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	var msgs = make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.String()
+	}
+	return "the request does not respect the API specification: " + strings.Join(msgs, "; ")
+}
+
+// ValidateRequest checks the path and query parameters and the JSON body of the request. It returns a
+// *ValidationError listing all the violations, if any. The body is read and replaced, so that handlers can read it
+// again.
+func (s *Spec) ValidateRequest(r *http.Request) error {
+	rt, pathValues := s.findRoute(r.Method, r.URL.Path)
+	if rt == nil {
+		return nil
+	}
+
+	var v validation
+	query := r.URL.Query()
+	for _, p := range rt.params {
+		switch p.In {
+		case "path":
+			s.validateParameter(&v, p, pathValues[p.Name])
+		case "query":
+			_, present := query[p.Name]
+			if !present && p.Required {
+				v.add("query", p.Name, "is required")
+			} else if present {
+				s.validateParameter(&v, p, query.Get(p.Name))
+			}
+		}
+	}
+
+	if rt.op.RequestBody != nil {
+		s.validateRequestBody(&v, r, rt.op.RequestBody)
+	}
+
+	if len(v.violations) > 0 {
+		return &ValidationError{Violations: v.violations}
+	}
+	return nil
+}
+
+// validateRequestBody checks the body of the request, if it's JSON. When the body has a media type not in the
+// specification, it's expected to be JSON if that is the only one allowed.
+func (s *Spec) validateRequestBody(v *validation, r *http.Request, body *requestBody) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	mt, ok := matchMediaType(body.Content, mediaType)
+	if !ok && len(body.Content) == 1 && body.Content["application/json"] != nil {
+		mt, mediaType, ok = body.Content["application/json"], "application/json", true
+	}
+	if !ok || !isJSON(mediaType) {
+		// Other media types (e.g., images) are validated by the handlers
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		v.add("body", "", "can't be read")
+		return
+	} else if len(data) > maxBodySize {
+		v.add("body", "", "is too large")
+		return
+	}
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		if body.Required {
+			v.add("body", "", "is required")
+		}
+		return
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		v.add("body", "", "is not valid JSON")
+		return
+	}
+	s.validateValue(v, "body", "", mt.Schema, value, true)
+}
+
+// ValidateResponse checks that the status of the response is in the specification of the operation requested by r,
+// and that JSON bodies match their schema. It returns the violations, if any.
+func (s *Spec) ValidateResponse(r *http.Request, status int, header http.Header, body []byte) []Violation {
+	rt, _ := s.findRoute(r.Method, r.URL.Path)
+	if rt == nil {
+		return nil
+	}
+
+	var v validation
+	resp, ok := rt.op.Responses[strconv.Itoa(status)]
+	if !ok {
+		resp, ok = rt.op.Responses["default"]
+	}
+	if !ok {
+		v.add("response", "", fmt.Sprintf("status %d is not documented", status))
+		return v.violations
+	}
+	resp, _ = s.resolveResponse(resp)
+	if len(resp.Content) == 0 {
+		if len(body) > 0 {
+			v.add("response", "", fmt.Sprintf("status %d has no body", status))
+		}
+		return v.violations
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	mt, ok := matchMediaType(resp.Content, mediaType)
+	if !ok {
+		v.add("response", "", fmt.Sprintf("content type %q is not documented", mediaType))
+		return v.violations
+	} else if !isJSON(mediaType) {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		v.add("response", "", "is not valid JSON")
+		return v.violations
+	}
+	s.validateValue(&v, "response", "", mt.Schema, value, false)
+	return v.violations
+}
+
+// matchMediaType returns the content for mediaType, possibly declared with a wildcard (e.g., `image/*`)
+func matchMediaType(content map[string]*mediaType, mediaType string) (*mediaType, bool) {
+	if mt, ok := content[mediaType]; ok {
+		return mt, true
+	}
+	if i := strings.Index(mediaType, "/"); i > 0 {
+		if mt, ok := content[mediaType[:i]+"/*"]; ok {
+			return mt, true
+		}
+	}
+	mt, ok := content["*/*"]
+	return mt, ok
+}
+
+// isJSON reports whether the media type is JSON (e.g., `application/json` or `application/problem+json`)
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// validation collects the violations found while validating a request or a response
+type validation struct {
+	violations []Violation
+}
+
+func (v *validation) add(in string, field string, message string) {
+	v.violations = append(v.violations, Violation{In: in, Field: field, Message: message})
+}
+
+// validateParameter checks the raw value of a path or query parameter, converting it to the schema type first
+func (s *Spec) validateParameter(v *validation, p *parameter, raw string) {
+	sc, _ := s.resolveSchema(p.Schema)
+	if sc == nil {
+		return
+	}
+
+	var value interface{} = raw
+	switch sc.Type {
+	case "integer":
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			v.add(p.In, p.Name, "must be an integer")
+			return
+		}
+		value = float64(n)
+	case "number":
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			v.add(p.In, p.Name, "must be a number")
+			return
+		}
+		value = n
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			v.add(p.In, p.Name, "must be a boolean")
+			return
+		}
+		value = b
+	}
+	s.validateValue(v, p.In, p.Name, sc, value, true)
+}
+
+// validateValue checks a JSON value (as decoded by encoding/json) against the schema. In requests, read-only
+// properties are not required.
+func (s *Spec) validateValue(v *validation, in string, field string, sc *schema, value interface{}, request bool) {
+	sc, _ = s.resolveSchema(sc)
+	if sc == nil {
+		return
+	}
+	for _, sub := range sc.AllOf {
+		s.validateValue(v, in, field, sub, value, request)
+	}
+
+	if value == nil {
+		if sc.Type != "" && !sc.Nullable {
+			v.add(in, field, "must not be null")
+		}
+		return
+	}
+
+	if len(sc.Enum) > 0 && !inEnum(sc.Enum, value) {
+		v.add(in, field, fmt.Sprintf("must be one of %s", formatEnum(sc.Enum)))
+	}
+
+	switch sc.Type {
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			v.add(in, field, "must be a string")
+			return
+		}
+		s.validateString(v, in, field, sc, str)
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok || (sc.Type == "integer" && n != float64(int64(n))) {
+			v.add(in, field, "must be "+article(sc.Type)+" "+sc.Type)
+			return
+		}
+		if sc.Minimum != nil && n < *sc.Minimum {
+			v.add(in, field, "must be at least "+strconv.FormatFloat(*sc.Minimum, 'f', -1, 64))
+		}
+		if sc.Maximum != nil && n > *sc.Maximum {
+			v.add(in, field, "must be at most "+strconv.FormatFloat(*sc.Maximum, 'f', -1, 64))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.add(in, field, "must be a boolean")
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			v.add(in, field, "must be an array")
+			return
+		}
+		if sc.MinItems != nil && len(items) < *sc.MinItems {
+			v.add(in, field, fmt.Sprintf("must have at least %d items", *sc.MinItems))
+		}
+		if sc.MaxItems != nil && len(items) > *sc.MaxItems {
+			v.add(in, field, fmt.Sprintf("must have at most %d items", *sc.MaxItems))
+		}
+		for i, item := range items {
+			s.validateValue(v, in, fmt.Sprintf("%s[%d]", field, i), sc.Items, item, request)
+		}
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			v.add(in, field, "must be an object")
+			return
+		}
+		s.validateObject(v, in, field, sc, obj, request)
+	default:
+		// Untyped schemas (e.g., allOf only) may still describe the properties of objects
+		if obj, ok := value.(map[string]interface{}); ok && (sc.Properties != nil || sc.Required != nil) {
+			s.validateObject(v, in, field, sc, obj, request)
+		}
+	}
+}
+
+func (s *Spec) validateString(v *validation, in string, field string, sc *schema, str string) {
+	n := utf8.RuneCountInString(str)
+	if sc.MinLength != nil && n < *sc.MinLength {
+		v.add(in, field, fmt.Sprintf("must be at least %d characters long", *sc.MinLength))
+	}
+	if sc.MaxLength != nil && n > *sc.MaxLength {
+		v.add(in, field, fmt.Sprintf("must be at most %d characters long", *sc.MaxLength))
+	}
+	if re := s.patterns[sc.Pattern]; re != nil && !re.MatchString(str) {
+		v.add(in, field, "must match the pattern "+sc.Pattern)
+	}
+
+	switch sc.Format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			v.add(in, field, "must be a date-time (RFC 3339)")
+		}
+	case "uuid":
+		if !uuidPattern.MatchString(str) {
+			v.add(in, field, "must be a UUID")
+		}
+	}
+}
+
+func (s *Spec) validateObject(v *validation, in string, field string, sc *schema, obj map[string]interface{}, request bool) {
+	for _, name := range sc.Required {
+		prop, _ := s.resolveSchema(sc.Properties[name])
+		if _, ok := obj[name]; !ok && !(request && prop != nil && prop.ReadOnly) {
+			v.add(in, joinField(field, name), "is required")
+		}
+	}
+
+	// Properties are checked in a stable order, so that violations are reported in the same order every time
+	var names = make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop, ok := sc.Properties[name]
+		if !ok {
+			if sc.AdditionalProperties != nil && !*sc.AdditionalProperties {
+				v.add(in, joinField(field, name), "is not allowed")
+			}
+			continue
+		}
+		s.validateValue(v, in, joinField(field, name), prop, obj[name], request)
+	}
+}
+
+// joinField returns the path of the property name of the object at field
+func joinField(field string, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+// inEnum reports whether value is one of the allowed values. Numbers are compared by value, as YAML decodes integers
+// while JSON decodes floats.
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		switch a := allowed.(type) {
+		case int:
+			if n, ok := value.(float64); ok && n == float64(a) {
+				return true
+			}
+		case float64:
+			if n, ok := value.(float64); ok && n == a {
+				return true
+			}
+		case string:
+			if str, ok := value.(string); ok && str == a {
+				return true
+			}
+		case bool:
+			if b, ok := value.(bool); ok && b == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func formatEnum(enum []interface{}) string {
+	var values = make([]string, len(enum))
+	for i := range enum {
+		values[i] = fmt.Sprint(enum[i])
+	}
+	return strings.Join(values, ", ")
+}
+
+// article returns the indefinite article for the type name
+func article(typeName string) string {
+	if strings.ContainsRune("aeiou", rune(typeName[0])) {
+		return "an"
+	}
+	return "a"
+}